@@ -2,13 +2,22 @@ package orm
 
 import (
 	"fmt"
+	"github.com/kwinh/go-orm/schema"
 	sqlBuilder "github.com/kwinh/go-sql-builder"
+	"reflect"
+	"strings"
 )
 
 func (d *DB) aggregate(sql string) (data int64, err error) {
 	defer d.resetClone()
 	db := d.getInstance()
 
+	if err = db.applyConditions(db.schema); err != nil {
+		return
+	}
+
+	db.applyScopes(db.schema, "")
+
 	if len(db.b.GetGroup()) > 0 {
 		db.sql, db.bindings = d.ClonePure(1).b.Select(sql).
 			Table(func() *sqlBuilder.Builder {
@@ -18,15 +27,7 @@ func (d *DB) aggregate(sql string) (data int64, err error) {
 		db.sql, db.bindings = db.b.Select(sql).ToSql()
 	}
 
-	rows, err := db.Query(db.sql, db.bindings...)
-	if err != nil {
-		return
-	}
-
-	defer rows.Close()
-	rows.Next()
-	rows.Scan(&data)
-
+	err = db.queryValue(&data)
 	return
 }
 
@@ -49,3 +50,133 @@ func (d *DB) Avg(field string) (int64, error) {
 func (d *DB) Sum(field string) (int64, error) {
 	return d.aggregate(fmt.Sprintf("SUM(%s)", field))
 }
+
+// withAggregate 关联聚合查询
+type withAggregate struct {
+	name     string
+	alias    string
+	function string
+	column   string
+	callback WithFunc
+}
+
+// WithCount 查询关联数据的数量，默认列名为 关联名_count，结果写入 OrdersCount 这样按命名约定或 `orm:"aggregate"` 标签声明的字段，
+// 也可以用 "Orders as paid_count" 指定列名
+//
+//	SELECT `id`,`name`,(SELECT COUNT(*) FROM `order` WHERE `order`.`user_id` = `user`.`id`) AS `orders_count` FROM `user`
+func (d *DB) WithCount(name string, callbacks ...WithFunc) *DB {
+	return d.withAggregate(name, "COUNT", "*", callbacks...)
+}
+
+// WithSum 查询关联数据 column 的和，默认列名为 关联名_sum_字段名，例如 OrdersSumAmount
+func (d *DB) WithSum(name string, column string, callbacks ...WithFunc) *DB {
+	return d.withAggregate(name, "SUM", column, callbacks...)
+}
+
+// WithAvg 查询关联数据 column 的平均值，默认列名为 关联名_avg_字段名
+func (d *DB) WithAvg(name string, column string, callbacks ...WithFunc) *DB {
+	return d.withAggregate(name, "AVG", column, callbacks...)
+}
+
+// WithMax 查询关联数据 column 的最大值，默认列名为 关联名_max_字段名
+func (d *DB) WithMax(name string, column string, callbacks ...WithFunc) *DB {
+	return d.withAggregate(name, "MAX", column, callbacks...)
+}
+
+// WithMin 查询关联数据 column 的最小值，默认列名为 关联名_min_字段名
+func (d *DB) WithMin(name string, column string, callbacks ...WithFunc) *DB {
+	return d.withAggregate(name, "MIN", column, callbacks...)
+}
+
+func (d *DB) withAggregate(name string, function string, column string, callbacks ...WithFunc) *DB {
+	db := d.getInstance()
+
+	var callback WithFunc
+	if len(callbacks) > 0 {
+		callback = callbacks[0]
+	}
+
+	// "Orders as paid_count" 指定结果的列名
+	var alias string
+	if index := strings.Index(name, " as "); index > 0 {
+		name, alias = strings.TrimSpace(name[:index]), strings.TrimSpace(name[index+4:])
+	}
+
+	db.aggregates = append(db.aggregates, withAggregate{
+		name:     name,
+		alias:    alias,
+		function: function,
+		column:   column,
+		callback: callback,
+	})
+	return db
+}
+
+// applyAggregates 把关联聚合的子查询加入查询字段，返回接收结果的字段及子查询的参数
+func (d *DB) applyAggregates(tableInfo *schema.Schema) (fields []*schema.Field, bindings []any, err error) {
+	if len(d.aggregates) == 0 {
+		return
+	}
+
+	table := tableInfo.TableName
+	if d.b.TableAlias != "" {
+		table = d.b.TableAlias
+	}
+
+	selectFields := d.b.GetField()
+
+	for _, aggregate := range d.aggregates {
+		alias := aggregate.alias
+		if alias == "" {
+			alias = schema.SnakeString(aggregate.name) + "_" + strings.ToLower(aggregate.function)
+			if aggregate.column != "*" {
+				alias += "_" + aggregate.column
+			}
+		}
+
+		field, ok := tableInfo.Aggregates[alias]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s.%s", ErrMissingAggregate, tableInfo.Name, alias)
+		}
+
+		with, ok := tableInfo.Withs[aggregate.name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s.%s", ErrMissingRelation, tableInfo.Name, aggregate.name)
+		}
+
+		if with.Type == schema.MorphTo {
+			return nil, nil, fmt.Errorf("%w: %s.%s", ErrRelationType, tableInfo.Name, aggregate.name)
+		}
+
+		column := aggregate.function + "(*)"
+		if aggregate.column != "*" {
+			column = fmt.Sprintf("COALESCE(%s(`%s`.`%s`), 0)", aggregate.function, relationTable(tableInfo, with, table), aggregate.column)
+		}
+
+		query, err := d.relationQuery(tableInfo, table, []string{aggregate.name}, aggregate.callback, sqlBuilder.Raw(column))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		b := sqlBuilder.NewBuilder("")
+		query(b)
+		sql, params := b.ToSql()
+
+		selectFields = append(selectFields, sqlBuilder.Raw(fmt.Sprintf("(%s) AS `%s`", sql, alias)))
+		fields = append(fields, field)
+		bindings = append(bindings, params...)
+	}
+
+	d.aggregates = nil
+	d.b.Select(selectFields...)
+	return
+}
+
+// aggregateScans 为关联聚合字段创建扫描目标
+func aggregateScans(fields []*schema.Field) []any {
+	scans := make([]any, len(fields))
+	for i, field := range fields {
+		scans[i] = reflect.New(field.StructField.Type).Interface()
+	}
+	return scans
+}
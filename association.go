@@ -0,0 +1,534 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+// Association 管理已加载模型的关联，例如 db.Association(&user, "Roles").Append(&role)
+type Association struct {
+	db    *DB
+	with  *With
+	owner reflect.Value
+	Error error
+}
+
+// Association 返回 value 上名为 name 的关联，value 必须是模型的指针
+func (d *DB) Association(value any, name string) *Association {
+	db := d.getInstance()
+	association := &Association{db: db}
+
+	ownerValue := reflect.ValueOf(value)
+	if ownerValue.Kind() != reflect.Ptr || ownerValue.Elem().Kind() != reflect.Struct {
+		association.Error = ErrParam
+		return association
+	}
+
+	tableInfo := schema.Parse(value, db.dialector, db.TablePrefix)
+	w, ok := tableInfo.Withs[name]
+	if !ok {
+		association.Error = fmt.Errorf("%w: %s.%s", ErrMissingRelation, tableInfo.Name, name)
+		return association
+	}
+
+	// morphTo 关联的模型类型不固定，远程关联不能通过中间模型写入
+	switch w.Type {
+	case schema.MorphTo, schema.HasOneThrough, schema.HasManyThrough:
+		association.Error = ErrRelationType
+		return association
+	}
+
+	w1 := *w
+	if w1.MorphType != nil {
+		w1.MorphValue = schema.MorphName(tableInfo)
+	}
+
+	association.owner = ownerValue.Elem()
+	association.with = &With{
+		With:     &w1,
+		Callback: func(*DB) {},
+	}
+	return association
+}
+
+// ownerKey 当前模型上用于关联的字段值
+func (a *Association) ownerKey() (any, error) {
+	if a.Error != nil {
+		return nil, a.Error
+	}
+
+	val := a.owner.FieldByName(a.with.LocalKey.Name)
+	if val.IsZero() {
+		return nil, ErrMissingCondition
+	}
+	return val.Interface(), nil
+}
+
+// transaction 已经在事务中时直接执行，否则开启一个事务
+func (a *Association) transaction(f TxFunc) error {
+	if a.db.tx != nil {
+		return f(a.db.ClonePure(1))
+	}
+	return a.db.Transaction(f)
+}
+
+// models 把传入的模型指针或模型切片指针展开为可寻址的模型
+func (a *Association) models(values ...any) (models []reflect.Value, err error) {
+	for _, value := range values {
+		val := reflect.ValueOf(value)
+		if val.Kind() != reflect.Ptr {
+			return nil, ErrParam
+		}
+		val = val.Elem()
+
+		switch {
+		case val.Type() == a.with.ModelType:
+			models = append(models, val)
+		case val.Kind() == reflect.Slice && val.Type().Elem() == a.with.ModelType:
+			for i := 0; i < val.Len(); i++ {
+				models = append(models, val.Index(i))
+			}
+		default:
+			return nil, ErrParam
+		}
+	}
+	return
+}
+
+// referenceKey 用于区分关联模型的字段，多对多为中间表关联的字段，其它关联为关联模型的主键
+func (a *Association) referenceKey() *schema.Field {
+	if a.with.Type == schema.ManyToMany {
+		return a.with.ForeignKey
+	}
+	return a.with.Schema.PrimaryKey
+}
+
+// slice 把模型组装成关联模型的切片
+func (a *Association) slice(models []reflect.Value) reflect.Value {
+	slice := schema.MakeSlice(a.with.ModelType).Elem()
+	for _, model := range models {
+		slice = reflect.Append(slice, model)
+	}
+	return slice
+}
+
+// Find 查询关联模型，dest 为关联模型或关联模型切片的指针
+func (a *Association) Find(dest any) error {
+	ownerKey, err := a.ownerKey()
+	if err != nil {
+		return err
+	}
+
+	db := a.db.ClonePure(1)
+
+	switch a.with.Type {
+	case schema.ManyToMany:
+		references, err := a.references(db, ownerKey)
+		if err != nil {
+			return err
+		}
+		if len(references) == 0 {
+			return ErrNotFind
+		}
+		return db.Where(a.with.ForeignKey.FieldName, "in", references).Get(dest)
+	default:
+		return a.morphWhere(db).Where(a.with.ForeignKey.FieldName, ownerKey).Get(dest)
+	}
+}
+
+// Count 统计关联模型数量
+func (a *Association) Count() (int64, error) {
+	ownerKey, err := a.ownerKey()
+	if err != nil {
+		return 0, err
+	}
+
+	db := a.db.ClonePure(1)
+
+	if a.with.Type == schema.ManyToMany {
+		return db.Table(a.with.JoinTable).Where(a.with.JoinForeignKey, ownerKey).Count()
+	}
+
+	return a.morphWhere(db.Model(reflect.New(a.with.ModelType).Interface())).
+		Where(a.with.ForeignKey.FieldName, ownerKey).Count()
+}
+
+// morphWhere 多态关联只查询类型字段为当前模型的记录
+func (a *Association) morphWhere(db *DB) *DB {
+	if a.with.MorphType != nil {
+		db.Where(a.with.MorphType.FieldName, a.with.MorphValue)
+	}
+	return db
+}
+
+// Append 添加关联，没有主键的关联模型会被创建
+func (a *Association) Append(values ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+
+	models, err := a.models(values...)
+	if err != nil {
+		return err
+	}
+
+	err = a.transaction(func(db *DB) error {
+		return a.append(db, models, false)
+	})
+
+	if err == nil {
+		a.appendOwner(models, false)
+	}
+	return err
+}
+
+// Replace 用传入的模型替换现有关联
+func (a *Association) Replace(values ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+
+	models, err := a.models(values...)
+	if err != nil {
+		return err
+	}
+
+	err = a.transaction(func(db *DB) error {
+		return a.append(db, models, true)
+	})
+
+	if err == nil {
+		a.appendOwner(models, true)
+	}
+	return err
+}
+
+// Delete 解除与传入模型的关联，不会删除关联模型本身
+func (a *Association) Delete(values ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+
+	models, err := a.models(values...)
+	if err != nil {
+		return err
+	}
+
+	if len(models) == 0 {
+		return nil
+	}
+
+	referenceKey := a.referenceKey()
+	if referenceKey == nil {
+		return ErrMissingCondition
+	}
+
+	references := make([]any, 0, len(models))
+	for _, model := range models {
+		if reference := model.FieldByName(referenceKey.Name); !reference.IsZero() {
+			references = append(references, reference.Interface())
+		}
+	}
+
+	if len(references) == 0 {
+		return nil
+	}
+
+	err = a.transaction(func(db *DB) error {
+		return a.remove(db, references, false)
+	})
+
+	if err == nil {
+		a.removeOwner(references)
+	}
+	return err
+}
+
+// Clear 解除所有关联，不会删除关联模型本身
+func (a *Association) Clear() error {
+	if a.Error != nil {
+		return a.Error
+	}
+
+	err := a.transaction(func(db *DB) error {
+		return a.remove(db, nil, false)
+	})
+
+	if err == nil {
+		field := a.owner.FieldByName(a.with.Name)
+		field.Set(reflect.Zero(field.Type()))
+	}
+	return err
+}
+
+// Attach 多对多关联写入中间表，pivotData 只传一个时作用于所有 ids，否则与 ids 一一对应
+func (a *Association) Attach(ids []any, pivotData ...map[string]any) error {
+	return a.syncPivots(ids, pivotData, false)
+}
+
+// Sync 多对多关联以 ids 为准同步中间表，不在 ids 中的记录会被删除
+func (a *Association) Sync(ids []any, pivotData ...map[string]any) error {
+	return a.syncPivots(ids, pivotData, true)
+}
+
+// Detach 多对多关联删除中间表记录，不传 ids 时删除所有记录
+func (a *Association) Detach(ids ...any) error {
+	if a.Error != nil {
+		return a.Error
+	}
+
+	if a.with.Type != schema.ManyToMany {
+		return ErrRelationType
+	}
+
+	return a.transaction(func(db *DB) error {
+		return a.remove(db, a.convertIds(ids), false)
+	})
+}
+
+// convertIds 把传入的 id 转换为关联键的类型，以便与中间表中已有的记录比较
+func (a *Association) convertIds(ids []any) []any {
+	keyType := a.with.ForeignKey.StructField.Type
+
+	values := make([]any, len(ids))
+	for i, id := range ids {
+		val := reflect.ValueOf(id)
+		if val.IsValid() && val.Type() != keyType && val.CanConvert(keyType) {
+			values[i] = val.Convert(keyType).Interface()
+		} else {
+			values[i] = id
+		}
+	}
+	return values
+}
+
+func (a *Association) syncPivots(ids []any, pivotData []map[string]any, detach bool) error {
+	ownerKey, err := a.ownerKey()
+	if err != nil {
+		return err
+	}
+
+	if a.with.Type != schema.ManyToMany {
+		return ErrRelationType
+	}
+
+	ids = a.convertIds(ids)
+
+	data := pivotData
+	if len(pivotData) == 1 && len(ids) > 1 {
+		data = make([]map[string]any, len(ids))
+		for i := range ids {
+			data[i] = pivotData[0]
+		}
+	}
+
+	return a.transaction(func(db *DB) error {
+		return db.syncPivots(a.with, ownerKey, ids, data, detach)
+	})
+}
+
+// references 多对多关联在中间表中的关联键
+func (a *Association) references(db *DB, ownerKey any) ([]any, error) {
+	pivots, err := db.getPivots(a.with, []any{ownerKey})
+	if err != nil {
+		return nil, err
+	}
+
+	references := make([]any, len(pivots))
+	for i, p := range pivots {
+		references[i] = p.reference
+	}
+	return references, nil
+}
+
+// append 写入关联，replace 为 true 时解除不在 models 中的关联
+func (a *Association) append(db *DB, models []reflect.Value, replace bool) error {
+	if a.with.Type == schema.BelongsTo {
+		return a.appendOwnerKey(db, models)
+	}
+
+	ownerKey, err := a.ownerKey()
+	if err != nil {
+		return err
+	}
+
+	slice := a.slice(models)
+
+	if a.with.Type == schema.ManyToMany {
+		if err = db.createPivotModels(db.ClonePure(1), a.with, slice); err != nil {
+			return err
+		}
+
+		// slice 中是副本，需要把新建的主键写回传入的模型
+		for i, model := range models {
+			model.Set(slice.Index(i))
+		}
+
+		references, data := db.pivotReferences(a.with, slice)
+		return db.syncPivots(a.with, ownerKey, references, data, replace)
+	}
+
+	single := a.with.Type == schema.One || a.with.Type == schema.MorphOne
+	if single && len(models) > 1 {
+		return ErrParam
+	}
+
+	primaryKey := a.with.Schema.PrimaryKey
+	if primaryKey == nil {
+		return ErrMissingCondition
+	}
+
+	references := make([]any, 0, len(models))
+	for _, model := range models {
+		foreignKey := model.FieldByName(a.with.ForeignKey.Name)
+		foreignKey.Set(reflect.ValueOf(ownerKey).Convert(foreignKey.Type()))
+
+		if a.with.MorphType != nil {
+			setMorphValue(model.FieldByName(a.with.MorphType.Name), a.with.MorphValue)
+		}
+
+		// 已有主键的关联模型只更新外键，否则创建
+		if model.FieldByName(primaryKey.Name).IsZero() {
+			_, err = db.ClonePure(1).Create(model.Addr().Interface())
+		} else {
+			_, err = db.ClonePure(1).Update(model.Addr().Interface())
+		}
+
+		if err != nil {
+			return err
+		}
+		references = append(references, model.FieldByName(primaryKey.Name).Interface())
+	}
+
+	// 一对一关联只能有一个关联模型，新增时也需要解除原有关联
+	if replace || single {
+		return a.remove(db, references, true)
+	}
+	return nil
+}
+
+// appendOwnerKey 反向关联把关联模型的键写回当前模型
+func (a *Association) appendOwnerKey(db *DB, models []reflect.Value) error {
+	if len(models) != 1 {
+		return ErrParam
+	}
+
+	model := models[0]
+	if model.FieldByName(a.with.ForeignKey.Name).IsZero() {
+		if _, err := db.ClonePure(1).Create(model.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	localKey := a.owner.FieldByName(a.with.LocalKey.Name)
+	localKey.Set(model.FieldByName(a.with.ForeignKey.Name).Convert(localKey.Type()))
+
+	return a.updateOwnerKey(db, localKey.Interface())
+}
+
+// updateOwnerKey 更新当前模型上反向关联的外键，按模型更新，会执行全局作用域和多租户检查，
+// 只写入外键字段，不会执行当前模型的钩子
+func (a *Association) updateOwnerKey(db *DB, value any) error {
+	tableInfo := schema.Parse(a.owner.Addr().Interface(), db.dialector, db.TablePrefix)
+
+	primaryKey, ok := primaryKeyValue(tableInfo)
+	if !ok {
+		return ErrMissingCondition
+	}
+
+	_, err := db.ClonePure(1).Model(reflect.New(tableInfo.Type).Interface()).
+		Where(tableInfo.PrimaryKey.FieldName, primaryKey).
+		Update(map[string]any{a.with.LocalKey.FieldName: value})
+	return err
+}
+
+// remove 解除关联，except 为 true 时解除 references 以外的关联，references 为空时解除所有关联；
+// 一对一、一对多按关联模型批量清空外键，会执行全局作用域和多租户检查，软删除的记录也会解除，
+// 和按条件更新一样不会执行关联模型的钩子和观察者
+func (a *Association) remove(db *DB, references []any, except bool) error {
+	if a.with.Type == schema.BelongsTo {
+		localKey := a.owner.FieldByName(a.with.LocalKey.Name)
+		zero := reflect.Zero(localKey.Type())
+		if err := a.updateOwnerKey(db, zero.Interface()); err != nil {
+			return err
+		}
+		localKey.Set(zero)
+		return nil
+	}
+
+	ownerKey, err := a.ownerKey()
+	if err != nil {
+		return err
+	}
+
+	if a.with.Type == schema.ManyToMany {
+		_, err = db.deletePivots(a.with, ownerKey, references)
+		return err
+	}
+
+	query := a.morphWhere(db.ClonePure(1).Model(reflect.New(a.with.ModelType).Interface()).WithDelete()).
+		Where(a.with.ForeignKey.FieldName, ownerKey)
+
+	if len(references) > 0 {
+		primaryKey := a.referenceKey().FieldName
+		if except {
+			query.Where(primaryKey, "not in", references)
+		} else {
+			query.Where(primaryKey, "in", references)
+		}
+	}
+
+	_, err = query.Update(map[string]any{
+		a.with.ForeignKey.FieldName: reflect.Zero(a.with.ForeignKey.StructField.Type).Interface(),
+	})
+	return err
+}
+
+// appendOwner 同步当前模型上的关联字段
+func (a *Association) appendOwner(models []reflect.Value, replace bool) {
+	field := a.owner.FieldByName(a.with.Name)
+
+	if field.Kind() != reflect.Slice {
+		if len(models) > 0 {
+			field.Set(models[len(models)-1])
+		}
+		return
+	}
+
+	if replace {
+		field.Set(reflect.Zero(field.Type()))
+	}
+
+	for _, model := range models {
+		field.Set(reflect.Append(field, model))
+	}
+}
+
+// removeOwner 从当前模型的关联字段中移除 references 对应的模型
+func (a *Association) removeOwner(references []any) {
+	field := a.owner.FieldByName(a.with.Name)
+
+	referenceKey := a.referenceKey()
+
+	removes := make(map[any]bool, len(references))
+	for _, reference := range references {
+		removes[reference] = true
+	}
+
+	if field.Kind() != reflect.Slice {
+		if removes[field.FieldByName(referenceKey.Name).Interface()] {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		return
+	}
+
+	slice := reflect.MakeSlice(field.Type(), 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		model := field.Index(i)
+		if !removes[model.FieldByName(referenceKey.Name).Interface()] {
+			slice = reflect.Append(slice, model)
+		}
+	}
+	field.Set(slice)
+}
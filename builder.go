@@ -1,6 +1,9 @@
 package orm
 
-import "github.com/kwinh/go-sql-builder"
+import (
+	"github.com/kwinh/go-orm/schema"
+	"github.com/kwinh/go-sql-builder"
+)
 
 func (d *DB) Select(args ...any) *DB {
 	db := d.getInstance()
@@ -23,112 +26,125 @@ func (d *DB) Table(table any) *DB {
 	return db
 }
 
-func (d *DB) Where(args ...any) *DB {
+// where 添加查询条件，之前有等到执行时才生成的关联条件时也推迟到执行时添加，保持调用的顺序
+func (d *DB) where(condition func(b *sqlBuilder.Builder)) *DB {
 	db := d.getInstance()
-	db.b.Where(args...)
+	if len(db.conditions) > 0 {
+		db.conditions = append(db.conditions, func(db *DB, _ *schema.Schema) {
+			condition(&db.b)
+		})
+	} else {
+		condition(&db.b)
+	}
 	return db
 }
 
+func (d *DB) Where(args ...any) *DB {
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.Where(args...)
+	})
+}
+
 func (d *DB) OrWhere(args ...any) *DB {
-	db := d.getInstance()
-	db.b.OrWhere(args...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhere(args...)
+	})
 }
 
 func (d *DB) WhereExists(where func(*sqlBuilder.Builder)) *DB {
-	db := d.getInstance()
-	db.b.WhereExists(where)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereExists(where)
+	})
 }
 
 func (d *DB) WhereNotExists(where func(*sqlBuilder.Builder)) *DB {
-	db := d.getInstance()
-	db.b.WhereNotExists(where)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereNotExists(where)
+	})
 }
 
 func (d *DB) OrWhereExists(where func(*sqlBuilder.Builder)) *DB {
-	db := d.getInstance()
-	db.b.OrWhereExists(where)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereExists(where)
+	})
 }
 
 func (d *DB) OrWhereNotExists(where func(*sqlBuilder.Builder)) *DB {
-	db := d.getInstance()
-	db.b.OrWhereNotExists(where)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereNotExists(where)
+	})
 }
 
 func (d *DB) WhereIn(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.WhereIn(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereIn(field, value...)
+	})
 }
 
 func (d *DB) WhereNotIn(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.WhereNotIn(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereNotIn(field, value...)
+	})
 }
 
 func (d *DB) OrWhereIn(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.OrWhereIn(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereIn(field, value...)
+	})
 }
 
 func (d *DB) OrWhereNotIn(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.OrWhereNotIn(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereNotIn(field, value...)
+	})
 }
 
 func (d *DB) WhereNull(field string) *DB {
-	db := d.getInstance()
-	db.b.WhereNull(field)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereNull(field)
+	})
 }
 
 func (d *DB) WhereNotNull(field string) *DB {
-	db := d.getInstance()
-	db.b.WhereNotNull(field)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereNotNull(field)
+	})
 }
 
 func (d *DB) OrWhereNull(field string) *DB {
-	db := d.getInstance()
-	db.b.OrWhereNull(field)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereNull(field)
+	})
 }
 
 func (d *DB) OrWhereNotNull(field string) *DB {
-	db := d.getInstance()
-	db.b.OrWhereNotNull(field)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereNotNull(field)
+	})
 }
 
 func (d *DB) WhereBetween(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.WhereBetween(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereBetween(field, value...)
+	})
 }
 
 func (d *DB) OrWhereBetween(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.OrWhereBetween(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereBetween(field, value...)
+	})
 }
 
 func (d *DB) WhereNotBetween(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.WhereNotBetween(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.WhereNotBetween(field, value...)
+	})
 }
 
 func (d *DB) OrWhereNotBetween(field string, value ...any) *DB {
-	db := d.getInstance()
-	db.b.OrWhereNotBetween(field, value...)
-	return db
+	return d.where(func(b *sqlBuilder.Builder) {
+		b.OrWhereNotBetween(field, value...)
+	})
 }
 
 func (d *DB) Group(group ...string) *DB {
@@ -187,6 +203,7 @@ func (d *DB) Join(table any, condition string, params ...any) *DB {
 
 func (d *DB) ToSql() (string, []any) {
 	db := d.getInstance()
+	db.AddError(db.applyConditions(db.schema))
 	return db.b.ToSql()
 }
 
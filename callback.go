@@ -0,0 +1,290 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"sync"
+)
+
+// Statement 回调收到的语句
+type Statement struct {
+	DB     *DB
+	Schema *schema.Schema
+	// Values 新增、更新时写入的字段，新增多条记录时每条记录一个 map；
+	// Before 回调修改 Values 后会重新生成语句
+	Values []map[string]any
+	// SQL、Vars 执行的语句及参数，Before 回调可以直接修改
+	SQL  string
+	Vars []any
+	// Dest 查询时接收结果的变量
+	Dest any
+	// RowsAffected、Error 执行结果，After 回调中可以使用
+	RowsAffected int64
+	Error        error
+}
+
+// CallbackFunc 回调函数，Before 回调返回错误时不执行语句
+type CallbackFunc func(*Statement) error
+
+// Callbacks 全局回调，按操作类型分组，所有模型的操作都会执行
+type Callbacks struct {
+	create *CallbackProcessor
+	query  *CallbackProcessor
+	update *CallbackProcessor
+	delete *CallbackProcessor
+	row    *CallbackProcessor
+	raw    *CallbackProcessor
+}
+
+func newCallbacks() *Callbacks {
+	return &Callbacks{
+		create: &CallbackProcessor{},
+		query:  &CallbackProcessor{},
+		update: &CallbackProcessor{},
+		delete: &CallbackProcessor{},
+		row:    &CallbackProcessor{},
+		raw:    &CallbackProcessor{},
+	}
+}
+
+// Callback 全局回调的注册表
+//
+//	db.Callback().Create().Before("created_by", func(stmt *orm.Statement) error {
+//		for _, values := range stmt.Values {
+//			values["created_by"] = userId
+//		}
+//		return nil
+//	})
+func (d *DB) Callback() *Callbacks {
+	return d.callback
+}
+
+// Create 新增、Upsert
+func (c *Callbacks) Create() *CallbackProcessor {
+	if c == nil {
+		return nil
+	}
+	return c.create
+}
+
+// Query Get、Find、First、Value 及聚合查询
+func (c *Callbacks) Query() *CallbackProcessor {
+	if c == nil {
+		return nil
+	}
+	return c.query
+}
+
+// Update 更新
+func (c *Callbacks) Update() *CallbackProcessor {
+	if c == nil {
+		return nil
+	}
+	return c.update
+}
+
+// Delete 删除及软删除
+func (c *Callbacks) Delete() *CallbackProcessor {
+	if c == nil {
+		return nil
+	}
+	return c.delete
+}
+
+// Row 直接调用 DB.Query 执行的查询
+func (c *Callbacks) Row() *CallbackProcessor {
+	if c == nil {
+		return nil
+	}
+	return c.row
+}
+
+// Raw 直接调用 DB.Exec 执行的语句
+func (c *Callbacks) Raw() *CallbackProcessor {
+	if c == nil {
+		return nil
+	}
+	return c.raw
+}
+
+// CallbackProcessor 一种操作的回调，分为执行语句前和执行语句后两组，两组的名称互不影响
+type CallbackProcessor struct {
+	mu     sync.RWMutex
+	before []*Callback
+	after  []*Callback
+}
+
+// Callback 已注册的回调
+type Callback struct {
+	processor *CallbackProcessor
+	name      string
+	fn        CallbackFunc
+	// before、after 在同一组中这些名称的回调之前、之后执行
+	before []string
+	after  []string
+}
+
+// Before 注册执行语句前的回调，执行语句前的回调中名称已经存在时替换原来的回调
+func (p *CallbackProcessor) Before(name string, fn CallbackFunc) *Callback {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	callback := &Callback{processor: p, name: name, fn: fn}
+	p.before = append(removeCallback(p.before, name), callback)
+	return callback
+}
+
+// After 注册执行语句后的回调，执行语句后的回调中名称已经存在时替换原来的回调
+func (p *CallbackProcessor) After(name string, fn CallbackFunc) *Callback {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	callback := &Callback{processor: p, name: name, fn: fn}
+	p.after = append(removeCallback(p.after, name), callback)
+	return callback
+}
+
+// Remove 删除执行语句前、执行语句后两组中名称为 name 的回调
+func (p *CallbackProcessor) Remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.before = removeCallback(p.before, name)
+	p.after = removeCallback(p.after, name)
+}
+
+func removeCallback(callbacks []*Callback, name string) []*Callback {
+	result := make([]*Callback, 0, len(callbacks))
+	for _, callback := range callbacks {
+		if callback.name != name {
+			result = append(result, callback)
+		}
+	}
+	return result
+}
+
+// Before 在同一组中指定名称的回调之前执行，没有注册的名称会被忽略
+//
+//	db.Callback().Update().Before("audit", audit).Before("created_by")
+func (c *Callback) Before(names ...string) *Callback {
+	c.processor.mu.Lock()
+	defer c.processor.mu.Unlock()
+	c.before = append(c.before, names...)
+	return c
+}
+
+// After 在同一组中指定名称的回调之后执行，没有注册的名称会被忽略
+//
+//	db.Callback().Update().Before("audit", audit).After("created_by")
+func (c *Callback) After(names ...string) *Callback {
+	c.processor.mu.Lock()
+	defer c.processor.mu.Unlock()
+	c.after = append(c.after, names...)
+	return c
+}
+
+// sortCallbacks 按 Before、After 指定的顺序排序，没有指定顺序的按注册顺序执行，循环依赖时按注册顺序执行剩余的回调
+func sortCallbacks(callbacks []*Callback) []*Callback {
+	if len(callbacks) < 2 {
+		return callbacks
+	}
+
+	// deps 每个回调需要等待执行完的回调
+	names := make(map[string]bool, len(callbacks))
+	deps := make(map[string][]string, len(callbacks))
+	for _, callback := range callbacks {
+		names[callback.name] = true
+		deps[callback.name] = append(deps[callback.name], callback.after...)
+		for _, name := range callback.before {
+			deps[name] = append(deps[name], callback.name)
+		}
+	}
+
+	sorted := make([]*Callback, 0, len(callbacks))
+	done := make(map[string]bool, len(callbacks))
+	for len(sorted) < len(callbacks) {
+		progress := false
+		for _, callback := range callbacks {
+			if done[callback.name] || !callbackReady(deps[callback.name], names, done) {
+				continue
+			}
+			sorted = append(sorted, callback)
+			done[callback.name] = true
+			progress = true
+		}
+
+		if !progress {
+			for _, callback := range callbacks {
+				if !done[callback.name] {
+					sorted = append(sorted, callback)
+					done[callback.name] = true
+				}
+			}
+		}
+	}
+	return sorted
+}
+
+func callbackReady(deps []string, names, done map[string]bool) bool {
+	for _, name := range deps {
+		if names[name] && !done[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *CallbackProcessor) callbacks() (before, after []*Callback) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return sortCallbacks(p.before), sortCallbacks(p.after)
+}
+
+// execute 生成语句，执行 Before 回调、语句、After 回调；Before 回调没有直接修改语句时，
+// 按回调修改后的 Values 重新生成语句
+func (p *CallbackProcessor) execute(stmt *Statement, build func() (string, []any, error), exec func(*Statement) error) error {
+	var err error
+	if stmt.SQL, stmt.Vars, err = build(); err != nil {
+		return err
+	}
+
+	var before, after []*Callback
+	if p != nil {
+		before, after = p.callbacks()
+	}
+
+	if len(before) > 0 {
+		sql := stmt.SQL
+		for _, callback := range before {
+			if err = callback.fn(stmt); err != nil {
+				return err
+			}
+		}
+
+		if stmt.SQL == sql && stmt.Values != nil {
+			if stmt.SQL, stmt.Vars, err = build(); err != nil {
+				return err
+			}
+		}
+	}
+
+	stmt.Error = exec(stmt)
+
+	for _, callback := range after {
+		if err = callback.fn(stmt); err != nil && stmt.Error == nil {
+			stmt.Error = err
+		}
+	}
+	return stmt.Error
+}
+
+// statementValues 新增的记录，包含不是 map[string]any 的参数时返回 nil，回调不能修改写入的字段
+func statementValues(args []any) []map[string]any {
+	values := make([]map[string]any, len(args))
+	for i, arg := range args {
+		value, ok := arg.(map[string]any)
+		if !ok {
+			return nil
+		}
+		values[i] = value
+	}
+	return values
+}
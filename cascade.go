@@ -0,0 +1,202 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+const (
+	OnDeleteCascade  = "cascade"
+	OnDeleteRestrict = "restrict"
+	OnDeleteSetNull  = "setNull"
+)
+
+// cascadeWiths 声明了 onDelete 的关联，反向关联、morphTo、远程关联不是当前模型拥有的数据，不做处理
+func cascadeWiths(tableInfo *schema.Schema) []*schema.With {
+	withs := make([]*schema.With, 0)
+	for _, with := range tableInfo.Withs {
+		switch with.Type {
+		case schema.BelongsTo, schema.MorphTo, schema.HasOneThrough, schema.HasManyThrough:
+			continue
+		}
+
+		switch with.OnDelete {
+		case OnDeleteCascade, OnDeleteRestrict, OnDeleteSetNull:
+			withs = append(withs, with)
+		}
+	}
+	return withs
+}
+
+// relationKeys 查询当前条件匹配的记录的关联键，键为当前模型的字段名
+func (d *DB) relationKeys(withs []*schema.With) (map[string][]any, error) {
+	fields := make([]any, 0, len(withs))
+	keyFields := make([]*schema.Field, 0, len(withs))
+	for _, with := range withs {
+		exists := false
+		for _, field := range keyFields {
+			if field == with.LocalKey {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			fields = append(fields, with.LocalKey.FieldName)
+			keyFields = append(keyFields, with.LocalKey)
+		}
+	}
+
+	db := d.ClonePure(1)
+	db.b = *d.b.Clone()
+	db.sql, db.bindings = db.b.Select(fields...).ToSql()
+
+	rows, err := db.query(db.sql, db.bindings...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string][]any, len(keyFields))
+	for rows.Next() {
+		values := make([]any, len(keyFields))
+		for i, field := range keyFields {
+			values[i] = reflect.New(field.StructField.Type).Interface()
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return nil, err
+		}
+
+		for i, field := range keyFields {
+			keys[field.Name] = append(keys[field.Name], reflect.ValueOf(values[i]).Elem().Interface())
+		}
+	}
+
+	return keys, rows.Err()
+}
+
+// relatedQuery 查询 keys 对应的关联模型
+func (d *DB) relatedQuery(with *schema.With, tableInfo *schema.Schema, keys []any) *DB {
+	db := d.ClonePure(1).Table(with.Schema.TableName).Where(with.ForeignKey.FieldName, "in", keys)
+	if with.MorphType != nil {
+		db.Where(with.MorphType.FieldName, schema.MorphName(tableInfo))
+	}
+	return db
+}
+
+// deleteRelations 删除当前条件匹配的记录前处理关联模型，soft 为 true 时当前模型是软删除：
+// restrict 存在关联数据时不允许删除；cascade 同时删除关联模型，软删除时只软删除支持软删除的关联模型；
+// setNull 把关联模型的外键置空，软删除时保留外键，以便恢复
+func (d *DB) deleteRelations(tableInfo *schema.Schema, soft bool) error {
+	withs := cascadeWiths(tableInfo)
+	if len(withs) == 0 {
+		return nil
+	}
+
+	allKeys, err := d.relationKeys(withs)
+	if err != nil {
+		return err
+	}
+
+	// 先检查所有 restrict 关联，避免已经处理了部分关联才发现不能删除
+	for _, with := range withs {
+		keys := allKeys[with.LocalKey.Name]
+		if with.OnDelete != OnDeleteRestrict || len(keys) == 0 {
+			continue
+		}
+
+		if err = d.restrictRelation(with, tableInfo, keys); err != nil {
+			return err
+		}
+	}
+
+	for _, with := range withs {
+		keys := allKeys[with.LocalKey.Name]
+		if len(keys) == 0 {
+			continue
+		}
+
+		switch with.OnDelete {
+		case OnDeleteSetNull:
+			if !soft {
+				err = d.setNullRelation(with, tableInfo, keys)
+			}
+		case OnDeleteCascade:
+			err = d.cascadeRelation(with, tableInfo, keys, soft)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restrictRelation 存在未删除的关联数据时返回 ErrDeleteRestricted
+func (d *DB) restrictRelation(with *schema.With, tableInfo *schema.Schema, keys []any) error {
+	var count int64
+	var err error
+
+	if with.Type == schema.ManyToMany {
+		count, err = d.ClonePure(1).Table(with.JoinTable).Where(with.JoinForeignKey, "in", keys).Count()
+	} else {
+		db := d.relatedQuery(with, tableInfo, keys)
+		if with.Schema.SoftDelete != nil {
+			db.whereTrashed(with.Schema.SoftDelete, "", false)
+		}
+		count, err = db.Count()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: %s.%s", ErrDeleteRestricted, tableInfo.Name, with.Name)
+	}
+	return nil
+}
+
+// setNullRelation 外键字段声明了 default:NULL 时置为 NULL，否则置为零值；多对多关联删除中间表记录
+func (d *DB) setNullRelation(with *schema.With, tableInfo *schema.Schema, keys []any) error {
+	if with.Type == schema.ManyToMany {
+		return d.deleteJoinRecords(with, keys)
+	}
+
+	var value any
+	if with.ForeignKey.DefaultValue != schema.DefaultNull {
+		value = reflect.Zero(with.ForeignKey.StructField.Type).Interface()
+	}
+
+	_, err := d.relatedQuery(with, tableInfo, keys).Update(map[string]any{with.ForeignKey.FieldName: value})
+	return err
+}
+
+// cascadeRelation 删除关联模型，关联模型上声明的 onDelete 会继续处理；多对多关联只删除中间表记录
+func (d *DB) cascadeRelation(with *schema.With, tableInfo *schema.Schema, keys []any, soft bool) error {
+	if with.Type == schema.ManyToMany {
+		if soft {
+			return nil
+		}
+		return d.deleteJoinRecords(with, keys)
+	}
+
+	if soft && with.Schema.SoftDelete == nil {
+		return nil
+	}
+
+	_, err := d.relatedQuery(with, tableInfo, keys).Delete(reflect.New(with.ModelType).Interface(), !soft)
+	return err
+}
+
+// deleteJoinRecords 删除 keys 在中间表中的所有记录
+func (d *DB) deleteJoinRecords(with *schema.With, keys []any) error {
+	db := d.ClonePure(1)
+	db.b.Table(with.JoinTable).Where(with.JoinForeignKey, "in", keys)
+
+	sql, params := db.b.Delete()
+	_, err := db.exec(sql, params...)
+	return err
+}
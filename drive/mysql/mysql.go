@@ -2,8 +2,9 @@ package mysql
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/kwinh/go-orm/drive"
 	"github.com/kwinh/go-orm/drive/mysql/migrator"
 	"github.com/kwinh/go-orm/schema"
@@ -21,7 +22,11 @@ type Dialect struct {
 	*Config
 }
 
-var _ schema.IDialect = (*Dialect)(nil)
+var (
+	_ schema.IDialect = (*Dialect)(nil)
+	_ schema.ILock    = (*Dialect)(nil)
+	_ schema.IRetry   = (*Dialect)(nil)
+)
 
 func (dialect *Dialect) Name() string {
 	return "mysql"
@@ -109,3 +114,33 @@ func (dialect *Dialect) Migrate(d schema.IDBParse) schema.IMigrator {
 
 	return migrate
 }
+
+// Lock 共享锁没有 SKIP LOCKED、NOWAIT 时使用兼容 5.7 的 LOCK IN SHARE MODE，否则使用 8.0 的 FOR SHARE
+func (dialect *Dialect) Lock(strength schema.LockStrength, option schema.LockOption) string {
+	var sql string
+	switch {
+	case strength == schema.LockUpdate:
+		sql = " FOR UPDATE"
+	case option == "":
+		return " LOCK IN SHARE MODE"
+	default:
+		sql = " FOR SHARE"
+	}
+
+	switch option {
+	case schema.LockSkipLocked:
+		sql += " SKIP LOCKED"
+	case schema.LockNoWait:
+		sql += " NOWAIT"
+	}
+	return sql
+}
+
+// Retryable 1213 死锁、1205 锁等待超时
+func (dialect *Dialect) Retryable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+	return false
+}
@@ -0,0 +1,557 @@
+package migrator
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"sort"
+	"strings"
+)
+
+// Migrator m struct
+type Migrator struct {
+	DB schema.IDBParse
+}
+
+var _ schema.IMigrator = (*Migrator)(nil)
+
+// column 表中的一列，由 information_schema.columns 或模型字段生成
+type column struct {
+	name         string
+	dataType     string
+	notNull      bool
+	defaultValue string
+}
+
+// info 列定义（不含列名），用于比较模型字段与表结构是否一致
+func (c column) info() string {
+	info := c.dataType
+	if c.notNull {
+		info += " NOT NULL"
+	}
+	if c.defaultValue != "" {
+		info += " DEFAULT " + c.defaultValue
+	}
+	return info
+}
+
+func (m Migrator) indexName(tableName, indexKey string) string {
+	// postgres 的索引名在整个 schema 内唯一，需要带上表名前缀
+	return tableName + "_" + indexKey
+}
+
+func (m Migrator) TableExist(tableName string) bool {
+	res, err := m.DB.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?", tableName)
+	if err != nil {
+		return false
+	}
+	defer res.Close()
+
+	var table string
+	res.Next()
+	_ = res.Scan(&table)
+
+	if table != "" {
+		return true
+	}
+	return false
+}
+
+// columnType 将 information_schema 中的类型还原为 DataTypeOf 返回的写法
+func (m Migrator) columnType(dataType string, charLength, precision, scale, datetimePrecision sql.NullInt64, defaultValue string) string {
+	switch dataType {
+	case "character varying":
+		if charLength.Valid {
+			return fmt.Sprintf("varchar(%d)", charLength.Int64)
+		}
+		return "varchar"
+	case "numeric":
+		if precision.Valid {
+			return fmt.Sprintf("numeric(%d,%d)", precision.Int64, scale.Int64)
+		}
+		return "numeric"
+	case "timestamp with time zone":
+		if datetimePrecision.Valid && datetimePrecision.Int64 < 6 {
+			return fmt.Sprintf("timestamptz(%d)", datetimePrecision.Int64)
+		}
+		return "timestamptz"
+	case "integer":
+		if strings.HasPrefix(defaultValue, "nextval(") {
+			return "serial"
+		}
+	case "bigint":
+		if strings.HasPrefix(defaultValue, "nextval(") {
+			return "bigserial"
+		}
+	}
+	return dataType
+}
+
+// columnDefault 去掉默认值上的类型转换，如 'abc'::character varying
+func (m Migrator) columnDefault(defaultValue string) string {
+	if strings.HasPrefix(defaultValue, "nextval(") {
+		return ""
+	}
+	if i := strings.LastIndex(defaultValue, "::"); i > 0 {
+		defaultValue = defaultValue[:i]
+	}
+	if defaultValue == string(schema.DefaultNull) {
+		return ""
+	}
+	return defaultValue
+}
+
+func (m Migrator) columns(tableName string) (columns []column, err error) {
+	res, err := m.DB.Query("SELECT column_name, data_type, is_nullable, column_default, character_maximum_length, numeric_precision, numeric_scale, datetime_precision "+
+		"FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? ORDER BY ordinal_position", tableName)
+	if err != nil {
+		return
+	}
+	defer res.Close()
+
+	for res.Next() {
+		var (
+			col               column
+			isNullable        string
+			defaultValue      sql.NullString
+			charLength        sql.NullInt64
+			precision         sql.NullInt64
+			scale             sql.NullInt64
+			datetimePrecision sql.NullInt64
+		)
+
+		if err = res.Scan(&col.name, &col.dataType, &isNullable, &defaultValue, &charLength, &precision, &scale, &datetimePrecision); err != nil {
+			return
+		}
+
+		col.notNull = isNullable == "NO"
+		col.dataType = m.columnType(col.dataType, charLength, precision, scale, datetimePrecision, defaultValue.String)
+		col.defaultValue = m.columnDefault(defaultValue.String)
+		columns = append(columns, col)
+	}
+	return
+}
+
+func (m Migrator) primaryKey(tableName string) (primaryKey string, constraint string) {
+	res, err := m.DB.Query("SELECT kcu.column_name, tc.constraint_name FROM information_schema.table_constraints tc "+
+		"JOIN information_schema.key_column_usage kcu ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema "+
+		"WHERE tc.table_schema = current_schema() AND tc.table_name = ? AND tc.constraint_type = 'PRIMARY KEY'", tableName)
+	if err != nil {
+		return
+	}
+	defer res.Close()
+
+	res.Next()
+	_ = res.Scan(&primaryKey, &constraint)
+	return
+}
+
+func (m Migrator) TableInfo(tableName string) schema.TableInfo {
+	fieldsInfo := make(map[string]string)
+	uniqueKeys := make(map[string][]string)
+	indexKeys := make(map[string][]string)
+	fullKeys := make(map[string][]string)
+
+	columns, _ := m.columns(tableName)
+	for _, col := range columns {
+		fieldsInfo[col.name] = col.info()
+	}
+
+	primaryKey, constraint := m.primaryKey(tableName)
+
+	res, err := m.DB.Query("SELECT indexname, indexdef FROM pg_indexes WHERE schemaname = current_schema() AND tablename = ?", tableName)
+	if err == nil {
+		defer res.Close()
+		for res.Next() {
+			var indexName, indexDef string
+			if err = res.Scan(&indexName, &indexDef); err != nil {
+				break
+			}
+
+			if indexName == constraint {
+				continue
+			}
+
+			// CREATE UNIQUE INDEX user_name_uni ON public."user" USING btree (name)
+			fields := strings.Split(indexDef[strings.LastIndex(indexDef, "(")+1:strings.LastIndex(indexDef, ")")], ",")
+			for i, field := range fields {
+				fields[i] = strings.Trim(field, "\" ")
+			}
+
+			indexKey := strings.TrimPrefix(indexName, tableName+"_")
+			switch {
+			case strings.HasPrefix(indexDef, "CREATE UNIQUE INDEX"):
+				uniqueKeys[indexKey] = fields
+			case strings.HasSuffix(indexKey, "_full"):
+				fullKeys[indexKey] = fields
+			default:
+				indexKeys[indexKey] = fields
+			}
+		}
+	}
+
+	return schema.TableInfo{
+		FieldsInfo: fieldsInfo,
+		PrimaryKey: primaryKey,
+		UniqueKeys: uniqueKeys,
+		IndexKeys:  indexKeys,
+		FullKeys:   fullKeys,
+	}
+}
+
+func (m Migrator) fieldColumn(field *schema.Field) column {
+	col := column{
+		name:     field.FieldName,
+		dataType: field.Type,
+	}
+
+	if field.AutoIncrement {
+		col.notNull = true
+		return col
+	}
+
+	if field.HavDefaultValue {
+		if field.DefaultValue != schema.DefaultNull {
+			col.notNull = true
+			col.defaultValue = fmt.Sprintf("%v", field.DefaultValue)
+		}
+		return col
+	}
+
+	switch field.DataType {
+	case schema.Time, schema.Json:
+	case schema.String:
+		if field.Size < 65536 {
+			col.notNull = true
+			col.defaultValue = "''"
+		}
+	case schema.Bool:
+		col.notNull = true
+		col.defaultValue = "false"
+	default:
+		col.notNull = true
+		col.defaultValue = "0"
+	}
+
+	return col
+}
+
+func (m Migrator) getFieldSql(field *schema.Field) string {
+	return fmt.Sprintf("\"%s\" %s", field.FieldName, m.fieldColumn(field).info())
+}
+
+func (m Migrator) comment(tableName string, field *schema.Field) error {
+	if field.Comment == "" {
+		return nil
+	}
+
+	sql := fmt.Sprintf("COMMENT ON COLUMN \"%s\".\"%s\" IS '%s'", tableName, field.FieldName, strings.ReplaceAll(field.Comment, "'", "''"))
+	_, err := m.DB.Exec(sql)
+	return err
+}
+
+func (m Migrator) Create(schema1 *schema.Schema) error {
+	sql := "CREATE TABLE \"" + schema1.TableName + "\" (\n"
+	for _, field := range schema1.Fields {
+		sql += m.getFieldSql(field) + ",\n"
+	}
+
+	if schema1.PrimaryKey != nil {
+		sql += "PRIMARY KEY (\"" + schema1.PrimaryKey.FieldName + "\"),\n"
+	}
+
+	sql = strings.Trim(sql, ",\n")
+	sql += "\n)"
+
+	_, err := m.DB.Exec(sql)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range schema1.Fields {
+		if err = m.comment(schema1.TableName, field); err != nil {
+			return err
+		}
+	}
+
+	for indexType, indexFields := range map[schema.IndexType]schema.IndexList{
+		schema.UNIQUEKEY:   schema1.UniqueKeys,
+		schema.INDEXKEY:    schema1.IndexKeys,
+		schema.FULLTEXTKEY: schema1.FullKeys,
+	} {
+		if len(indexFields) == 0 {
+			continue
+		}
+		if err = m.AddIndex(schema1.TableName, indexType, indexFields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m Migrator) AddField(TableName string, field *schema.Field) error {
+	sql := fmt.Sprintf("ALTER TABLE \"%s\" ADD COLUMN %s", TableName, m.getFieldSql(field))
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return m.comment(TableName, field)
+}
+
+func (m Migrator) ModifyField(TableName string, field *schema.Field) error {
+	col := m.fieldColumn(field)
+
+	dataType := col.dataType
+	switch dataType {
+	case "serial":
+		dataType = "integer"
+	case "bigserial":
+		dataType = "bigint"
+	}
+
+	alters := []string{
+		fmt.Sprintf("ALTER COLUMN \"%s\" TYPE %s USING \"%s\"::%s", col.name, dataType, col.name, dataType),
+	}
+
+	if !field.AutoIncrement {
+		if col.defaultValue != "" {
+			alters = append(alters, fmt.Sprintf("ALTER COLUMN \"%s\" SET DEFAULT %s", col.name, col.defaultValue))
+		} else {
+			alters = append(alters, fmt.Sprintf("ALTER COLUMN \"%s\" DROP DEFAULT", col.name))
+		}
+	}
+
+	if col.notNull {
+		alters = append(alters, fmt.Sprintf("ALTER COLUMN \"%s\" SET NOT NULL", col.name))
+	} else {
+		alters = append(alters, fmt.Sprintf("ALTER COLUMN \"%s\" DROP NOT NULL", col.name))
+	}
+
+	sql := fmt.Sprintf("ALTER TABLE \"%s\" %s", TableName, strings.Join(alters, ", "))
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return m.comment(TableName, field)
+}
+
+func (m Migrator) DropField(TableName string, FiledName string) error {
+	sql := fmt.Sprintf("ALTER TABLE \"%s\" DROP COLUMN \"%s\"", TableName, FiledName)
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m Migrator) AddIndex(tableName string, indexType schema.IndexType, indexFields schema.IndexList) error {
+	for key, fields := range indexFields {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Priority < fields[j].Priority })
+
+		fieldNames := make([]string, len(fields))
+		for i, field := range fields {
+			fieldNames[i] = "\"" + field.Field.FieldName + "\""
+		}
+
+		var sql string
+		switch indexType {
+		case schema.PrimaryKey:
+			sql = fmt.Sprintf("ALTER TABLE \"%s\" ADD PRIMARY KEY (%s)", tableName, strings.Join(fieldNames, ","))
+		case schema.UNIQUEKEY:
+			sql = fmt.Sprintf("CREATE UNIQUE INDEX \"%s\" ON \"%s\" (%s)", m.indexName(tableName, key), tableName, strings.Join(fieldNames, ","))
+		default:
+			sql = fmt.Sprintf("CREATE INDEX \"%s\" ON \"%s\" (%s)", m.indexName(tableName, key), tableName, strings.Join(fieldNames, ","))
+		}
+
+		if _, err := m.DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m Migrator) DropIndex(indexKey, tableName string) error {
+
+	sql := fmt.Sprintf("DROP INDEX \"%s\"", m.indexName(tableName, indexKey))
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m Migrator) DropPrimaryIndex(tableName string) error {
+	_, constraint := m.primaryKey(tableName)
+	if constraint == "" {
+		return nil
+	}
+
+	sql := fmt.Sprintf("ALTER TABLE \"%s\" DROP CONSTRAINT \"%s\"", tableName, constraint)
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m Migrator) UpdateIndex(schema1 *schema.Schema, schemaKeys schema.IndexList, keys map[string][]string, modify bool, indexType schema.IndexType) (err error) {
+	for key, fields := range schemaKeys {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Priority < fields[j].Priority })
+
+		indexFields := make(schema.IndexList)
+		indexFields[key] = fields
+
+		if fields1, ok := keys[key]; !ok {
+			err = m.AddIndex(schema1.TableName, indexType, indexFields)
+			if err != nil {
+				return err
+			}
+		} else if modify && !m.sameIndex(fields1, fields) {
+			err = m.DropIndex(key, schema1.TableName)
+			if err != nil {
+				return err
+			}
+			err = m.AddIndex(schema1.TableName, indexType, indexFields)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+func (m Migrator) sameIndex(fieldNames []string, fields []schema.Index) bool {
+	if len(fieldNames) != len(fields) {
+		return false
+	}
+
+	for i, fieldName := range fieldNames {
+		if fieldName != fields[i].Field.FieldName {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Migrator) Auto(value any, modify, drop bool) error {
+	schema1 := m.DB.Parse(value)
+	if !m.TableExist(schema1.TableName) {
+		return m.Create(schema1)
+	}
+
+	tableInfo := m.TableInfo(schema1.TableName)
+
+	for _, field := range schema1.Fields {
+		if fieldInfo, ok := tableInfo.FieldsInfo[field.FieldName]; !ok {
+			err := m.AddField(schema1.TableName, field)
+			if err != nil {
+				return err
+			}
+		} else {
+			if modify {
+				if fieldInfo != m.fieldColumn(field).info() {
+					err := m.ModifyField(schema1.TableName, field)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if drop {
+		for fieldName := range tableInfo.FieldsInfo {
+			if schema1.GetField(fieldName) == nil {
+				err := m.DropField(schema1.TableName, fieldName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// 删除列时依赖该列的索引会被一起删除，需要重新读取
+		tableInfo = m.TableInfo(schema1.TableName)
+
+		err := m.DropIndexList(tableInfo.UniqueKeys, schema1.UniqueKeys, schema1.TableName)
+		if err != nil {
+			return err
+		}
+
+		err = m.DropIndexList(tableInfo.IndexKeys, schema1.IndexKeys, schema1.TableName)
+		if err != nil {
+			return err
+		}
+
+		err = m.DropIndexList(tableInfo.FullKeys, schema1.FullKeys, schema1.TableName)
+		if err != nil {
+			return err
+		}
+
+		if schema1.PrimaryKey == nil && tableInfo.PrimaryKey != "" {
+			err := m.DropPrimaryIndex(schema1.TableName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if modify && schema1.PrimaryKey != nil && tableInfo.PrimaryKey != schema1.PrimaryKey.FieldName {
+		if tableInfo.PrimaryKey != "" {
+			err := m.DropPrimaryIndex(schema1.TableName)
+			if err != nil {
+				return err
+			}
+		}
+
+		indexFields := make(schema.IndexList)
+		indexFields["primaryKey"] = []schema.Index{{
+			Priority: 0,
+			Field:    schema1.PrimaryKey,
+		}}
+		err := m.AddIndex(schema1.TableName, schema.PrimaryKey, indexFields)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := m.UpdateIndex(schema1, schema1.UniqueKeys, tableInfo.UniqueKeys, modify, schema.UNIQUEKEY)
+	if err != nil {
+		return err
+	}
+
+	err = m.UpdateIndex(schema1, schema1.IndexKeys, tableInfo.IndexKeys, modify, schema.INDEXKEY)
+	if err != nil {
+		return err
+	}
+
+	err = m.UpdateIndex(schema1, schema1.FullKeys, tableInfo.FullKeys, modify, schema.FULLTEXTKEY)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m Migrator) DropIndexList(keys map[string][]string, schemaKeys schema.IndexList, tableName string) error {
+	for key := range keys {
+		if _, ok := schemaKeys[key]; !ok {
+			err := m.DropIndex(key, tableName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
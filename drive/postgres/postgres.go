@@ -0,0 +1,252 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/kwinh/go-orm/drive"
+	"github.com/kwinh/go-orm/drive/postgres/migrator"
+	"github.com/kwinh/go-orm/schema"
+	"github.com/lib/pq"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const DriverName = "postgres"
+
+type Config struct {
+	DSN  string
+	Conn drive.IConnPool
+}
+
+type Dialect struct {
+	*Config
+}
+
+var (
+	_ schema.IDialect   = (*Dialect)(nil)
+	_ schema.IRebind    = (*Dialect)(nil)
+	_ schema.IReturning = (*Dialect)(nil)
+	_ schema.IConflict  = (*Dialect)(nil)
+	_ schema.ILock      = (*Dialect)(nil)
+	_ schema.IUpsert    = (*Dialect)(nil)
+	_ schema.IRetry     = (*Dialect)(nil)
+)
+
+func (dialect *Dialect) Name() string {
+	return "postgres"
+}
+
+func (dialect *Dialect) GetDSN() string {
+	return dialect.Config.DSN
+}
+
+func (dialect *Dialect) DataTypeOf(field *schema.Field) (fieldType string) {
+	switch field.DataType {
+	case schema.Bool:
+		return "boolean"
+	case schema.String:
+		if field.Size == 0 {
+			field.Size = 255
+		}
+		if field.Size > 0 && field.Size < 65536 {
+			return fmt.Sprintf("varchar(%d)", field.Size)
+		}
+		return "text"
+	case schema.Int, schema.Uint:
+		size := field.Size
+		// postgres 没有无符号整型，使用更大一级的类型存放
+		if field.DataType == schema.Uint && size < 64 {
+			size *= 2
+		}
+
+		if field.AutoIncrement {
+			if size <= 32 {
+				return "serial"
+			}
+			return "bigserial"
+		}
+
+		if size <= 16 {
+			return "smallint"
+		} else if size <= 32 {
+			return "integer"
+		}
+		return "bigint"
+	case schema.Float:
+		if field.Decimal != "" {
+			return fmt.Sprintf("numeric(%s)", field.Decimal)
+		} else if field.Size <= 32 {
+			return "real"
+		}
+		return "double precision"
+	case schema.Time:
+		if field.Size == 0 || field.Size >= 6 {
+			return "timestamptz"
+		}
+		return fmt.Sprintf("timestamptz(%d)", field.Size)
+	case schema.Json:
+		return "jsonb"
+	}
+
+	return
+}
+
+func (dialect *Dialect) Init() (connPool drive.IConnPool, err error) {
+	if dialect.Conn == nil {
+		db, err := sql.Open(DriverName, dialect.DSN)
+
+		if err != nil {
+			return db, err
+		}
+		err = db.Ping()
+		if err != nil {
+			return db, err
+		}
+		dialect.Conn = db
+	}
+
+	connPool = dialect.Conn
+
+	return
+}
+
+func Open(dsn string) *Dialect {
+	return &Dialect{Config: &Config{DSN: dsn}}
+}
+
+func (dialect *Dialect) Migrate(d schema.IDBParse) schema.IMigrator {
+	migrate := &migrator.Migrator{
+		DB: d,
+	}
+
+	return migrate
+}
+
+var limitRegexp = regexp.MustCompile(` LIMIT (\d+),(\d+)`)
+
+// Rebind 将 go-sql-builder 生成的 mysql 风格语句改写为 postgres 语法：
+// 反引号改为双引号，? 占位符改为 $n，LIMIT offset,count 改为 LIMIT count OFFSET offset
+func (dialect *Dialect) Rebind(sql string) string {
+	var (
+		builder  strings.Builder
+		n        int
+		inString bool
+	)
+	builder.Grow(len(sql) + 16)
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+			builder.WriteByte(c)
+		case inString && c == '\\' && i+1 < len(sql):
+			// 反斜杠转义的字符原样保留，\' 不会结束字符串
+			builder.WriteByte(c)
+			i++
+			builder.WriteByte(sql[i])
+		case inString:
+			builder.WriteByte(c)
+		case c == '`':
+			builder.WriteByte('"')
+		case c == '?':
+			n++
+			builder.WriteByte('$')
+			builder.WriteString(strconv.Itoa(n))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+
+	return limitRegexp.ReplaceAllString(builder.String(), " LIMIT $2 OFFSET $1")
+}
+
+// Returning 插入时通过 RETURNING 取回主键
+func (dialect *Dialect) Returning(field *schema.Field) string {
+	return fmt.Sprintf(" RETURNING `%s`", field.FieldName)
+}
+
+// Conflict 将 REPLACE INTO 与 ON DUPLICATE KEY UPDATE 改写为 ON CONFLICT
+func (dialect *Dialect) Conflict(sql string, conflict []string) string {
+	conflictFields := make([]string, len(conflict))
+	isConflict := make(map[string]bool)
+	for i, field := range conflict {
+		conflictFields[i] = "`" + field + "`"
+		isConflict[field] = true
+	}
+	target := "(" + strings.Join(conflictFields, ",") + ")"
+
+	if strings.HasPrefix(sql, "REPLACE INTO ") {
+		sql = "INSERT INTO " + strings.TrimPrefix(sql, "REPLACE INTO ")
+
+		start := strings.Index(sql, "(")
+		end := strings.Index(sql, ")")
+		if start < 0 || end < start {
+			return sql
+		}
+
+		sets := make([]string, 0)
+		for _, field := range strings.Split(sql[start+1:end], ",") {
+			if isConflict[strings.Trim(field, "` ")] {
+				continue
+			}
+			sets = append(sets, fmt.Sprintf("%s=EXCLUDED.%s", field, field))
+		}
+
+		if len(sets) == 0 {
+			return sql + " ON CONFLICT " + target + " DO NOTHING"
+		}
+		return sql + " ON CONFLICT " + target + " DO UPDATE SET " + strings.Join(sets, ",")
+	}
+
+	return strings.Replace(sql, " ON DUPLICATE KEY UPDATE ", " ON CONFLICT "+target+" DO UPDATE SET ", 1)
+}
+
+// Lock 行锁子句
+func (dialect *Dialect) Lock(strength schema.LockStrength, option schema.LockOption) string {
+	sql := " FOR UPDATE"
+	if strength == schema.LockShare {
+		sql = " FOR SHARE"
+	}
+
+	switch option {
+	case schema.LockSkipLocked:
+		sql += " SKIP LOCKED"
+	case schema.LockNoWait:
+		sql += " NOWAIT"
+	}
+	return sql
+}
+
+// Upsert 冲突时更新为 EXCLUDED 中的值
+func (dialect *Dialect) Upsert(sql string, columns []string, update []string, doNothing bool) string {
+	target := ""
+	if len(columns) > 0 {
+		conflictFields := make([]string, len(columns))
+		for i, field := range columns {
+			conflictFields[i] = "`" + field + "`"
+		}
+		target = "(" + strings.Join(conflictFields, ",") + ") "
+	}
+
+	if doNothing {
+		return sql + " ON CONFLICT " + target + "DO NOTHING"
+	}
+
+	sets := make([]string, len(update))
+	for i, field := range update {
+		sets[i] = fmt.Sprintf("`%s`=EXCLUDED.`%s`", field, field)
+	}
+	return sql + " ON CONFLICT " + target + "DO UPDATE SET " + strings.Join(sets, ",")
+}
+
+// Retryable 40001 序列化失败、40P01 死锁
+func (dialect *Dialect) Retryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
@@ -0,0 +1,715 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/kwinh/go-orm/drive"
+	"github.com/kwinh/go-orm/schema"
+	"sort"
+	"strings"
+)
+
+// Migrator m struct
+type Migrator struct {
+	DB schema.IDBParse
+	// Conn 重建表时需要在同一个连接上关闭外键约束并开启事务
+	Conn drive.IConnPool
+}
+
+// connector *sql.DB 可以取得单独的连接
+type connector interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+var _ schema.IMigrator = (*Migrator)(nil)
+
+// column 表中的一列，由 PRAGMA table_info 或模型字段生成
+type column struct {
+	name          string
+	dataType      string
+	notNull       bool
+	defaultValue  sql.NullString
+	autoIncrement bool
+}
+
+// info 列定义（不含列名），用于比较模型字段与表结构是否一致
+func (c column) info() string {
+	if c.autoIncrement {
+		return c.dataType + " PRIMARY KEY AUTOINCREMENT"
+	}
+
+	info := c.dataType
+	if c.notNull {
+		info += " NOT NULL"
+	}
+	if c.defaultValue.Valid {
+		info += " DEFAULT " + c.defaultValue.String
+	}
+	return info
+}
+
+func (c column) sql() string {
+	return fmt.Sprintf("`%s` %s", c.name, c.info())
+}
+
+// index 通过 CREATE INDEX 创建的索引
+type index struct {
+	name   string
+	unique bool
+	fields []string
+	sql    string
+}
+
+func (m Migrator) indexName(tableName, indexKey string) string {
+	// sqlite 的索引名在整个库内唯一，需要带上表名前缀
+	return tableName + "_" + indexKey
+}
+
+func (m Migrator) TableExist(tableName string) bool {
+	res, err := m.DB.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", tableName)
+	if err != nil {
+		return false
+	}
+	defer res.Close()
+
+	var table string
+	res.Next()
+	_ = res.Scan(&table)
+
+	if table != "" {
+		return true
+	}
+	return false
+}
+
+func (m Migrator) createSql(tableName string) string {
+	res, err := m.DB.Query("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", tableName)
+	if err != nil {
+		return ""
+	}
+	defer res.Close()
+
+	var sql string
+	res.Next()
+	_ = res.Scan(&sql)
+	return sql
+}
+
+// columns 按表中顺序返回所有列以及主键列名
+func (m Migrator) columns(tableName string) (columns []column, primaryKey string, err error) {
+	res, err := m.DB.Query(fmt.Sprintf("PRAGMA table_info(`%s`)", tableName))
+	if err != nil {
+		return
+	}
+	defer res.Close()
+
+	for res.Next() {
+		var (
+			cid int
+			pk  int
+			col column
+		)
+
+		if err = res.Scan(&cid, &col.name, &col.dataType, &col.notNull, &col.defaultValue, &pk); err != nil {
+			return
+		}
+
+		// PRAGMA 返回的类型大小写与建表语句不一定一致
+		col.dataType = strings.ToLower(col.dataType)
+
+		if pk == 1 {
+			primaryKey = col.name
+		}
+		columns = append(columns, col)
+	}
+
+	if primaryKey != "" && strings.Contains(strings.ToUpper(m.createSql(tableName)), "AUTOINCREMENT") {
+		for i := range columns {
+			if columns[i].name == primaryKey {
+				columns[i].autoIncrement = true
+			}
+		}
+	}
+
+	return
+}
+
+// indexes 返回通过 CREATE INDEX 创建的索引，不包含主键和约束生成的自动索引
+func (m Migrator) indexes(tableName string) (indexes []index, err error) {
+	res, err := m.DB.Query(fmt.Sprintf("PRAGMA index_list(`%s`)", tableName))
+	if err != nil {
+		return
+	}
+
+	for res.Next() {
+		var (
+			seq     int
+			origin  string
+			partial bool
+			idx     index
+		)
+
+		if err = res.Scan(&seq, &idx.name, &idx.unique, &origin, &partial); err != nil {
+			res.Close()
+			return
+		}
+
+		if origin == "c" {
+			indexes = append(indexes, idx)
+		}
+	}
+	res.Close()
+
+	for i, idx := range indexes {
+		if indexes[i].fields, err = m.indexFields(idx.name); err != nil {
+			return
+		}
+
+		res, err = m.DB.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND name = ?", idx.name)
+		if err != nil {
+			return
+		}
+		res.Next()
+		_ = res.Scan(&indexes[i].sql)
+		res.Close()
+	}
+
+	return
+}
+
+func (m Migrator) indexFields(indexName string) (fields []string, err error) {
+	res, err := m.DB.Query(fmt.Sprintf("PRAGMA index_info(`%s`)", indexName))
+	if err != nil {
+		return
+	}
+	defer res.Close()
+
+	for res.Next() {
+		var (
+			seqno int
+			cid   int
+			name  string
+		)
+
+		if err = res.Scan(&seqno, &cid, &name); err != nil {
+			return
+		}
+		fields = append(fields, name)
+	}
+	return
+}
+
+func (m Migrator) TableInfo(tableName string) schema.TableInfo {
+	fieldsInfo := make(map[string]string)
+	uniqueKeys := make(map[string][]string)
+	indexKeys := make(map[string][]string)
+	fullKeys := make(map[string][]string)
+
+	columns, primaryKey, _ := m.columns(tableName)
+	for _, col := range columns {
+		fieldsInfo[col.name] = col.info()
+	}
+
+	indexes, _ := m.indexes(tableName)
+	for _, idx := range indexes {
+		indexKey := strings.TrimPrefix(idx.name, tableName+"_")
+
+		// sqlite 没有全文索引，模型中的全文索引建成了普通索引，Auto 中按模型区分
+		if idx.unique {
+			uniqueKeys[indexKey] = idx.fields
+		} else {
+			indexKeys[indexKey] = idx.fields
+		}
+	}
+
+	return schema.TableInfo{
+		FieldsInfo: fieldsInfo,
+		PrimaryKey: primaryKey,
+		UniqueKeys: uniqueKeys,
+		IndexKeys:  indexKeys,
+		FullKeys:   fullKeys,
+	}
+}
+
+func (m Migrator) fieldColumn(field *schema.Field) column {
+	col := column{
+		name:     field.FieldName,
+		dataType: field.Type,
+	}
+
+	if field.AutoIncrement {
+		// 只有 INTEGER PRIMARY KEY 才会成为 rowid 的别名
+		col.dataType = "integer"
+		col.autoIncrement = true
+		return col
+	}
+
+	defaultValue := ""
+	if field.HavDefaultValue {
+		defaultValue = fmt.Sprintf("%v", field.DefaultValue)
+	} else {
+		switch field.DataType {
+		case schema.Time, schema.Json:
+			defaultValue = string(schema.DefaultNull)
+		case schema.String:
+			if field.Size >= 65536 {
+				defaultValue = string(schema.DefaultNull)
+			} else {
+				defaultValue = "''"
+			}
+		default:
+			// ADD COLUMN 的 NOT NULL 列必须带默认值
+			defaultValue = "0"
+		}
+	}
+
+	col.notNull = defaultValue != string(schema.DefaultNull)
+	col.defaultValue = sql.NullString{String: defaultValue, Valid: true}
+	return col
+}
+
+func (m Migrator) getFieldSql(field *schema.Field) string {
+	return m.fieldColumn(field).sql()
+}
+
+func (m Migrator) tableSql(tableName string, columns []column, primaryKey string) string {
+	sql := "CREATE TABLE `" + tableName + "` (\n"
+	inline := false
+	for _, col := range columns {
+		sql += col.sql() + ",\n"
+		if col.name == primaryKey && col.autoIncrement {
+			inline = true
+		}
+	}
+
+	if primaryKey != "" && !inline {
+		sql += "PRIMARY KEY (`" + primaryKey + "`),\n"
+	}
+
+	sql = strings.Trim(sql, ",\n")
+	sql += "\n)"
+	return sql
+}
+
+func (m Migrator) Create(schema1 *schema.Schema) error {
+	columns := make([]column, len(schema1.Fields))
+	for i, field := range schema1.Fields {
+		columns[i] = m.fieldColumn(field)
+	}
+
+	primaryKey := ""
+	if schema1.PrimaryKey != nil {
+		primaryKey = schema1.PrimaryKey.FieldName
+	}
+
+	_, err := m.DB.Exec(m.tableSql(schema1.TableName, columns, primaryKey))
+	if err != nil {
+		return err
+	}
+
+	for indexType, indexFields := range map[schema.IndexType]schema.IndexList{
+		schema.UNIQUEKEY:   schema1.UniqueKeys,
+		schema.INDEXKEY:    schema1.IndexKeys,
+		schema.FULLTEXTKEY: schema1.FullKeys,
+	} {
+		if len(indexFields) == 0 {
+			continue
+		}
+		if err = m.AddIndex(schema1.TableName, indexType, indexFields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuild sqlite 不支持修改、删除列以及修改主键，按官方推荐的步骤重建表：
+// 新建表、复制数据、删除旧表、重命名新表、重建索引
+func (m Migrator) rebuild(tableName string, columns []column, primaryKey string) error {
+	indexes, err := m.indexes(tableName)
+	if err != nil {
+		return err
+	}
+
+	oldColumns, _, err := m.columns(tableName)
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[string]bool)
+	for _, col := range oldColumns {
+		exists[col.name] = true
+	}
+
+	fieldNames := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if exists[col.name] {
+			fieldNames = append(fieldNames, "`"+col.name+"`")
+		}
+	}
+	fieldsStr := strings.Join(fieldNames, ",")
+
+	newTableName := "new_" + tableName
+	sqls := []string{
+		m.tableSql(newTableName, columns, primaryKey),
+		fmt.Sprintf("INSERT INTO `%s` (%s) SELECT %s FROM `%s`", newTableName, fieldsStr, fieldsStr, tableName),
+		fmt.Sprintf("DROP TABLE `%s`", tableName),
+		fmt.Sprintf("ALTER TABLE `%s` RENAME TO `%s`", newTableName, tableName),
+	}
+
+	columnMap := make(map[string]bool)
+	for _, col := range columns {
+		columnMap[col.name] = true
+	}
+
+	for _, idx := range indexes {
+		keep := true
+		for _, field := range idx.fields {
+			if !columnMap[field] {
+				keep = false
+				break
+			}
+		}
+		if keep && idx.sql != "" {
+			sqls = append(sqls, idx.sql)
+		}
+	}
+
+	return m.execRebuild(sqls)
+}
+
+// execRebuild 在一个事务中执行重建表的语句，失败时回滚，不会留下 new_ 表或删掉原表；
+// 删除旧表时不能触发外键的级联操作，按官方的步骤在事务外关闭外键约束，提交前检查外键
+func (m Migrator) execRebuild(sqls []string) (err error) {
+	pool, ok := m.Conn.(connector)
+	if !ok {
+		return errors.New("sqlite migrator: rebuild table requires *sql.DB connection")
+	}
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var foreignKeys bool
+	if err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return err
+	}
+
+	if foreignKeys {
+		if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			_, err1 := conn.ExecContext(ctx, "PRAGMA foreign_keys=ON")
+			if err1 != nil {
+				// 没能恢复外键约束的连接不能放回连接池
+				_ = conn.Raw(func(any) error {
+					return driver.ErrBadConn
+				})
+			}
+			if err == nil {
+				err = err1
+			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, sql := range sqls {
+		if _, err = tx.ExecContext(ctx, sql); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("%s: %w", sql, err)
+		}
+	}
+
+	if foreignKeys {
+		var rows *sql.Rows
+		if rows, err = tx.QueryContext(ctx, "PRAGMA foreign_key_check"); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		violated := rows.Next()
+		rows.Close()
+
+		if violated {
+			_ = tx.Rollback()
+			return errors.New("sqlite migrator: rebuild table violates foreign key constraints")
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m Migrator) AddField(TableName string, field *schema.Field) error {
+	if field.PrimaryKey {
+		columns, _, err := m.columns(TableName)
+		if err != nil {
+			return err
+		}
+		return m.rebuild(TableName, append(columns, m.fieldColumn(field)), field.FieldName)
+	}
+
+	sql := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN %s", TableName, m.getFieldSql(field))
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m Migrator) ModifyField(TableName string, field *schema.Field) error {
+	columns, primaryKey, err := m.columns(TableName)
+	if err != nil {
+		return err
+	}
+
+	for i, col := range columns {
+		if col.name == field.FieldName {
+			columns[i] = m.fieldColumn(field)
+		}
+	}
+
+	if field.AutoIncrement {
+		primaryKey = field.FieldName
+	}
+
+	return m.rebuild(TableName, columns, primaryKey)
+}
+
+func (m Migrator) DropField(TableName string, FiledName string) error {
+	columns, primaryKey, err := m.columns(TableName)
+	if err != nil {
+		return err
+	}
+
+	newColumns := make([]column, 0, len(columns))
+	for _, col := range columns {
+		if col.name != FiledName {
+			newColumns = append(newColumns, col)
+		}
+	}
+
+	if primaryKey == FiledName {
+		primaryKey = ""
+	}
+
+	return m.rebuild(TableName, newColumns, primaryKey)
+}
+
+func (m Migrator) AddIndex(tableName string, indexType schema.IndexType, indexFields schema.IndexList) error {
+	for key, fields := range indexFields {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Priority < fields[j].Priority })
+
+		if indexType == schema.PrimaryKey {
+			return m.setPrimaryKey(tableName, fields[0].Field.FieldName)
+		}
+
+		fieldNames := make([]string, len(fields))
+		for i, field := range fields {
+			fieldNames[i] = "`" + field.Field.FieldName + "`"
+		}
+
+		unique := ""
+		if indexType == schema.UNIQUEKEY {
+			unique = "UNIQUE "
+		}
+
+		sql := fmt.Sprintf("CREATE %sINDEX `%s` ON `%s` (%s)", unique, m.indexName(tableName, key), tableName, strings.Join(fieldNames, ","))
+		if _, err := m.DB.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m Migrator) DropIndex(indexKey, tableName string) error {
+
+	sql := fmt.Sprintf("DROP INDEX `%s`", m.indexName(tableName, indexKey))
+	_, err := m.DB.Exec(sql)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m Migrator) setPrimaryKey(tableName string, primaryKey string) error {
+	columns, _, err := m.columns(tableName)
+	if err != nil {
+		return err
+	}
+
+	for i := range columns {
+		if columns[i].name != primaryKey {
+			columns[i].autoIncrement = false
+		}
+	}
+
+	return m.rebuild(tableName, columns, primaryKey)
+}
+
+func (m Migrator) DropPrimaryIndex(tableName string) error {
+	return m.setPrimaryKey(tableName, "")
+}
+
+func (m Migrator) UpdateIndex(schema1 *schema.Schema, schemaKeys schema.IndexList, keys map[string][]string, modify bool, indexType schema.IndexType) (err error) {
+	for key, fields := range schemaKeys {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Priority < fields[j].Priority })
+
+		indexFields := make(schema.IndexList)
+		indexFields[key] = fields
+
+		if fields1, ok := keys[key]; !ok {
+			err = m.AddIndex(schema1.TableName, indexType, indexFields)
+			if err != nil {
+				return err
+			}
+		} else if modify && !m.sameIndex(fields1, fields) {
+			err = m.DropIndex(key, schema1.TableName)
+			if err != nil {
+				return err
+			}
+			err = m.AddIndex(schema1.TableName, indexType, indexFields)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+func (m Migrator) sameIndex(fieldNames []string, fields []schema.Index) bool {
+	if len(fieldNames) != len(fields) {
+		return false
+	}
+
+	for i, fieldName := range fieldNames {
+		if fieldName != fields[i].Field.FieldName {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Migrator) Auto(value any, modify, drop bool) error {
+	schema1 := m.DB.Parse(value)
+	if !m.TableExist(schema1.TableName) {
+		return m.Create(schema1)
+	}
+
+	tableInfo := m.fullKeys(m.TableInfo(schema1.TableName), schema1)
+
+	for _, field := range schema1.Fields {
+		if fieldInfo, ok := tableInfo.FieldsInfo[field.FieldName]; !ok {
+			err := m.AddField(schema1.TableName, field)
+			if err != nil {
+				return err
+			}
+		} else {
+			if modify {
+				if fieldInfo != m.fieldColumn(field).info() {
+					err := m.ModifyField(schema1.TableName, field)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if drop {
+		for fieldName := range tableInfo.FieldsInfo {
+			if schema1.GetField(fieldName) == nil {
+				err := m.DropField(schema1.TableName, fieldName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// 删除列时会连同索引一起重建，需要重新读取
+		tableInfo = m.fullKeys(m.TableInfo(schema1.TableName), schema1)
+
+		err := m.DropIndexList(tableInfo.UniqueKeys, schema1.UniqueKeys, schema1.TableName)
+		if err != nil {
+			return err
+		}
+
+		err = m.DropIndexList(tableInfo.IndexKeys, schema1.IndexKeys, schema1.TableName)
+		if err != nil {
+			return err
+		}
+
+		err = m.DropIndexList(tableInfo.FullKeys, schema1.FullKeys, schema1.TableName)
+		if err != nil {
+			return err
+		}
+
+		if schema1.PrimaryKey == nil && tableInfo.PrimaryKey != "" {
+			err := m.DropPrimaryIndex(schema1.TableName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if modify && schema1.PrimaryKey != nil && tableInfo.PrimaryKey != schema1.PrimaryKey.FieldName {
+		err := m.setPrimaryKey(schema1.TableName, schema1.PrimaryKey.FieldName)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := m.UpdateIndex(schema1, schema1.UniqueKeys, tableInfo.UniqueKeys, modify, schema.UNIQUEKEY)
+	if err != nil {
+		return err
+	}
+
+	err = m.UpdateIndex(schema1, schema1.IndexKeys, tableInfo.IndexKeys, modify, schema.INDEXKEY)
+	if err != nil {
+		return err
+	}
+
+	err = m.UpdateIndex(schema1, schema1.FullKeys, tableInfo.FullKeys, modify, schema.FULLTEXTKEY)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// fullKeys 模型中声明为全文索引的普通索引归到 FullKeys
+func (m Migrator) fullKeys(tableInfo schema.TableInfo, schema1 *schema.Schema) schema.TableInfo {
+	for key, fields := range tableInfo.IndexKeys {
+		if _, ok := schema1.FullKeys[key]; ok {
+			tableInfo.FullKeys[key] = fields
+			delete(tableInfo.IndexKeys, key)
+		}
+	}
+	return tableInfo
+}
+
+func (m Migrator) DropIndexList(keys map[string][]string, schemaKeys schema.IndexList, tableName string) error {
+	for key := range keys {
+		if _, ok := schemaKeys[key]; !ok {
+			err := m.DropIndex(key, tableName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
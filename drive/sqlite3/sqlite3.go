@@ -2,12 +2,14 @@ package sqlite3
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/kwinh/go-orm/drive"
-	"github.com/kwinh/go-orm/drive/mysql/migrator"
+	"github.com/kwinh/go-orm/drive/sqlite3/migrator"
 	"github.com/kwinh/go-orm/schema"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"math"
+	"strings"
 )
 
 const DriverName = "sqlite3"
@@ -21,7 +23,12 @@ type Dialect struct {
 	*Config
 }
 
-var _ schema.IDialect = (*Dialect)(nil)
+var (
+	_ schema.IDialect   = (*Dialect)(nil)
+	_ schema.IReturning = (*Dialect)(nil)
+	_ schema.IUpsert    = (*Dialect)(nil)
+	_ schema.IRetry     = (*Dialect)(nil)
+)
 
 func (dialect *Dialect) Name() string {
 	return "sqlite"
@@ -69,10 +76,8 @@ func (dialect *Dialect) DataTypeOf(field *schema.Field) (fieldType string) {
 			return "double"
 		}
 	case schema.Time:
-		if field.Size == 0 {
-			field.Size = 3
-		}
-		return fmt.Sprintf("datetime(%d)", field.Size)
+		// go-sqlite3 只有声明类型为 datetime 时才会解析成 time.Time
+		return "datetime"
 	}
 
 	return
@@ -85,6 +90,14 @@ func (dialect *Dialect) Init() (connPool drive.IConnPool, err error) {
 		if err != nil {
 			return db, err
 		}
+
+		// 内存数据库的每个连接都是独立的数据库，只能使用一个连接
+		if isMemory(dialect.DSN) {
+			db.SetMaxOpenConns(1)
+			db.SetConnMaxLifetime(0)
+			db.SetConnMaxIdleTime(0)
+		}
+
 		err = db.Ping()
 		if err != nil {
 			return db, err
@@ -97,14 +110,52 @@ func (dialect *Dialect) Init() (connPool drive.IConnPool, err error) {
 	return
 }
 
+// isMemory dsn 是否为内存数据库，例如 :memory:、file::memory:、file:test.db?mode=memory
+func isMemory(dsn string) bool {
+	return strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
+
 func Open(dsn string) *Dialect {
 	return &Dialect{Config: &Config{DSN: dsn}}
 }
 
 func (dialect *Dialect) Migrate(d schema.IDBParse) schema.IMigrator {
 	migrate := &migrator.Migrator{
-		DB: d,
+		DB:   d,
+		Conn: dialect.Conn,
 	}
 
 	return migrate
 }
+
+// Returning 批量插入时 LastInsertId 返回的是最后一行的主键，通过 RETURNING 取回每一行的主键
+func (dialect *Dialect) Returning(field *schema.Field) string {
+	return fmt.Sprintf(" RETURNING `%s`", field.FieldName)
+}
+
+// Upsert 冲突时忽略使用 INSERT OR IGNORE，更新使用 ON CONFLICT ... DO UPDATE SET，需要 sqlite 3.24 以上
+func (dialect *Dialect) Upsert(sql string, columns []string, update []string, doNothing bool) string {
+	if doNothing {
+		return strings.Replace(sql, "INSERT", "INSERT OR IGNORE", 1)
+	}
+
+	conflictFields := make([]string, len(columns))
+	for i, field := range columns {
+		conflictFields[i] = "`" + field + "`"
+	}
+
+	sets := make([]string, len(update))
+	for i, field := range update {
+		sets[i] = fmt.Sprintf("`%s`=excluded.`%s`", field, field)
+	}
+	return sql + " ON CONFLICT (" + strings.Join(conflictFields, ",") + ") DO UPDATE SET " + strings.Join(sets, ",")
+}
+
+// Retryable 数据库文件被其他连接锁定
+func (dialect *Dialect) Retryable(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
@@ -10,4 +10,16 @@ var (
 	ErrMissingCondition = errors.New("missing condition")
 	ErrMissingTableName = errors.New("missing table name")
 	ErrInvalidDB        = errors.New("invalid db")
+	ErrMissingConflict  = errors.New("missing conflict columns")
+	ErrMissingRelation  = errors.New("missing relation")
+	ErrRelationType     = errors.New("unsupported relation type")
+	ErrMissingModel     = errors.New("missing model")
+	ErrMissingAggregate = errors.New("missing aggregate field")
+	ErrMissingMorph     = errors.New("missing morph model")
+	ErrDeleteRestricted = errors.New("delete restricted by relation")
+	ErrNotSoftDelete    = errors.New("model does not support soft delete")
+	ErrCrossTenant      = errors.New("cross tenant write")
+	ErrStaleObject      = errors.New("stale object")
+	ErrMissingTx        = errors.New("missing transaction")
+	ErrReturningIds     = errors.New("returning ids mismatch")
 )
@@ -1,11 +1,11 @@
 package orm
 
 import (
-	"database/sql"
+	"fmt"
 	"github.com/kwinh/go-orm/schema"
 	"reflect"
+	"strings"
 	"sync"
-	"time"
 )
 
 func (d *DB) OmitEmpty() *DB {
@@ -23,81 +23,198 @@ func (d *DB) insertReplace(mode string, args ...any) (result int64, err error) {
 		fieldType = fieldType.Elem()
 	}
 
+	// 有关联模型时逐条创建，每条记录的钩子和观察者在 Create 中执行
 	if fieldType.Kind() == reflect.Struct {
 		tableInfo := db.getTableInfo(args[0])
 
-		if model, ok := tableInfo.Value.Addr().Interface().(IBeforeCreate); ok {
-			err = model.BeforeCreate(db)
-			if err != nil {
-				return
+		if len(db.withs) > 0 {
+			withs := db.makeWiths(tableInfo)
+			// 已经在事务中时创建保存点，关联模型写入失败只回滚本次写入
+			err = db.Transaction(func(query *DB) error {
+				query = query.Select(db.getField()...)
+				query.childWiths = db.childWiths
+				result, err = query.withCreateGroup(withs, args...)
+				return err
+			})
+			return
+		}
+	}
+
+	argsMap, structParams := db.structToMap(args...)
+	if db.Error != nil {
+		return 0, db.Error
+	}
+
+	stmt := &Statement{DB: db, Schema: db.schema, Values: statementValues(argsMap)}
+	build := func() (sql string, params []any, err error) {
+		args := argsMap
+		if stmt.Values != nil {
+			args = make([]any, len(stmt.Values))
+			for i, values := range stmt.Values {
+				args[i] = values
 			}
 		}
 
-		if len(db.withs) > 0 {
-			withs := db.makeWiths(tableInfo)
-			if db.tx == nil {
-				db.Transaction(func(query *DB) error {
-					result, err = query.Select(db.getField()...).withCreateGroup(withs, args...)
-					return err
-				})
-				return
-			} else {
-				result, err = db.withCreateGroup(withs, args...)
+		if mode == "REPLACE" {
+			sql, params = db.b.Clone().Replace(args...)
+		} else {
+			sql, params = db.b.Clone().Insert(args...)
+		}
+
+		if db.onConflict != nil {
+			if sql, err = db.upsertSql(sql, args); err != nil {
 				return
 			}
+		} else if conflict, ok := db.dialector.(schema.IConflict); ok && (mode == "REPLACE" || strings.Contains(sql, " ON DUPLICATE KEY UPDATE ")) {
+			if db.schema == nil || db.schema.PrimaryKey == nil {
+				return "", nil, ErrMissingConflict
+			}
+			sql = conflict.Conflict(sql, []string{db.schema.PrimaryKey.FieldName})
+		}
+
+		if db.insertReturningId(structParams) {
+			sql += db.dialector.(schema.IReturning).Returning(db.schema.PrimaryKey)
 		}
+		return
 	}
 
-	argsMap, structParams := db.structToMap(args...)
+	err = db.callback.Create().execute(stmt, build, func(stmt *Statement) (err error) {
+		if db.insertReturningId(structParams) {
+			stmt.RowsAffected, err = db.insertReturning(stmt.SQL, stmt.Vars, structParams)
+			return
+		}
 
-	var sql string
-	var params []any
-	if mode == "REPLACE" {
-		sql, params = db.b.Replace(argsMap...)
-	} else {
-		sql, params = db.b.Insert(argsMap...)
+		res, err := db.exec(stmt.SQL, stmt.Vars...)
+		if err != nil {
+			return
+		}
+
+		// 冲突时更新的记录没有新的主键，Upsert 多条记录时 LastInsertId 无法对应到每一条记录
+		if len(structParams) == 1 || (len(structParams) > 0 && db.onConflict == nil) {
+
+			tableInfo := db.schema
+			if tableInfo.PrimaryKey != nil &&
+				(tableInfo.PrimaryKey.DataType == schema.Int ||
+					tableInfo.PrimaryKey.DataType == schema.Uint) {
+
+				var id int64
+				id, err = res.LastInsertId()
+				if err != nil {
+					return
+				}
+
+				// Upsert 冲突且没有记下冲突的记录时为 0，不回写主键
+				if id == 0 && db.onConflict != nil {
+					stmt.RowsAffected, err = res.RowsAffected()
+					return
+				}
+
+				ids := make([]int64, len(structParams))
+				for i := range ids {
+					ids[i] = id + int64(i)
+				}
+
+				if err = db.setInsertIds(structParams, ids); err != nil {
+					return
+				}
+			}
+		}
+
+		stmt.RowsAffected, err = res.RowsAffected()
+		return
+	})
+
+	if err == nil {
+		err = db.afterCreate(structParams)
+	}
+	return stmt.RowsAffected, err
+}
+
+// afterCreate 写入成功后对每条记录执行 AfterCreate、Created、Saved 及提交后的钩子，不依赖主键的类型，Upsert 不执行
+func (d *DB) afterCreate(structParams []any) error {
+	if d.onConflict != nil {
+		return nil
 	}
 
-	res, err := db.Exec(sql, params...)
+	for _, arg := range structParams {
+		argValue := reflect.ValueOf(arg).Elem()
+		if model, ok := argValue.Addr().Interface().(IAfterCreate); ok {
+			if err := model.AfterCreate(d); err != nil {
+				return err
+			}
+		}
 
+		if err := d.observeCreated(argValue); err != nil {
+			return err
+		}
+
+		d.afterCommitCreate(argValue)
+	}
+	return nil
+}
+
+// insertReturningId 方言支持 RETURNING 时通过 RETURNING 子句取回自增主键
+func (d *DB) insertReturningId(structParams []any) bool {
+	if len(structParams) == 0 || d.schema.PrimaryKey == nil ||
+		(d.schema.PrimaryKey.DataType != schema.Int && d.schema.PrimaryKey.DataType != schema.Uint) {
+		return false
+	}
+	_, ok := d.dialector.(schema.IReturning)
+	return ok
+}
+
+// insertReturning 通过 RETURNING 子句取回每一行的主键
+func (d *DB) insertReturning(sql string, params []any, structParams []any) (result int64, err error) {
+	rows, err := d.query(sql, params...)
 	if err != nil {
 		return
 	}
 
-	if len(structParams) > 0 {
+	ids := make([]int64, 0, len(structParams))
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
 
-		tableInfo := db.schema
-		if tableInfo.PrimaryKey != nil &&
-			(tableInfo.PrimaryKey.DataType == schema.Int ||
-				tableInfo.PrimaryKey.DataType == schema.Uint) {
+	if err = rows.Err(); err != nil {
+		return
+	}
 
-			var id int64
-			id, err = res.LastInsertId()
-			if err != nil {
-				return
+	if len(ids) != len(structParams) {
+		// 冲突时忽略的记录不会返回主键，无法对应到每一条记录；只写入一条记录时按冲突字段查出已有记录的主键
+		if d.onConflict != nil {
+			if len(ids) == 0 && len(structParams) == 1 {
+				err = d.upsertConflictId(structParams[0])
 			}
+			return int64(len(ids)), err
+		}
+		return int64(len(ids)), fmt.Errorf("%w: %d ids for %d rows", ErrReturningIds, len(ids), len(structParams))
+	}
 
-			for i, arg := range structParams {
-				argValue := reflect.ValueOf(arg).Elem()
-				id1 := id + int64(i)
-				if tableInfo.PrimaryKey.DataType == schema.Int {
-					argValue.FieldByName(tableInfo.PrimaryKey.Name).SetInt(id1)
-				} else if tableInfo.PrimaryKey.DataType == schema.Uint {
-					argValue.FieldByName(tableInfo.PrimaryKey.Name).SetUint(uint64(id1))
-				}
+	if err = d.setInsertIds(structParams, ids); err != nil {
+		return
+	}
 
-				if model, ok := argValue.Addr().Interface().(IAfterCreate); ok {
-					err = model.AfterCreate(db)
-					if err != nil {
-						return
-					}
-				}
+	return int64(len(ids)), nil
+}
 
-			}
+// setInsertIds 回写自增主键，创建后的钩子在 afterCreate 中执行
+func (d *DB) setInsertIds(structParams []any, ids []int64) (err error) {
+	tableInfo := d.schema
+	for i, arg := range structParams {
+		argValue := reflect.ValueOf(arg).Elem()
+		if tableInfo.PrimaryKey.DataType == schema.Int {
+			argValue.FieldByName(tableInfo.PrimaryKey.Name).SetInt(ids[i])
+		} else if tableInfo.PrimaryKey.DataType == schema.Uint {
+			argValue.FieldByName(tableInfo.PrimaryKey.Name).SetUint(uint64(ids[i]))
 		}
 	}
-
-	return res.RowsAffected()
+	return
 }
 
 func (d *DB) Create(args ...any) (result int64, err error) {
@@ -148,6 +265,22 @@ func (d *DB) createModel(wg *sync.WaitGroup, withs []*With, rowsAffected chan in
 		return
 	}
 
+	// 反向关联的外键在当前模型上，需要先创建关联模型
+	for _, with := range withs {
+		var err error
+		switch with.Type {
+		case schema.BelongsTo:
+			err = d.withCreateOwner(arg, with)
+		case schema.MorphTo:
+			err = d.withCreateMorphOwner(arg, with)
+		}
+
+		if err != nil {
+			d.AddError(err)
+			return
+		}
+	}
+
 	affected, err := d.ClonePure().Select(field...).Create(arg)
 
 	if err != nil {
@@ -160,12 +293,49 @@ func (d *DB) createModel(wg *sync.WaitGroup, withs []*With, rowsAffected chan in
 	wg1 := &sync.WaitGroup{}
 
 	for _, with := range withs {
+		// 远程关联只能查询，不会创建中间模型
+		switch with.Type {
+		case schema.BelongsTo, schema.MorphTo, schema.HasOneThrough, schema.HasManyThrough:
+			continue
+		}
 		wg1.Add(1)
 		go d.withCreate(arg, with, wg1)
 	}
 	wg1.Wait()
 }
 
+func (d *DB) withCreateOwner(arg any, with *With) error {
+	argValue := reflect.ValueOf(arg).Elem()
+	ownerModel := argValue.FieldByName(with.Name)
+
+	if ownerModel.IsZero() {
+		return nil
+	}
+
+	// 关联模型已存在时只回写外键
+	if ownerModel.FieldByName(with.ForeignKey.Name).IsZero() {
+		db := d.ClonePure(1)
+
+		for modelName, funcList := range d.childWiths {
+			db.With(modelName, funcList...)
+		}
+
+		with.Callback(db)
+
+		if _, err := db.Create(ownerModel.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	localKey := argValue.FieldByName(with.LocalKey.Name)
+	ownerKey := ownerModel.FieldByName(with.ForeignKey.Name)
+	if !ownerKey.CanConvert(localKey.Type()) {
+		return fmt.Errorf("%w: %s %s to %s", ErrRelationType, with.Name, ownerKey.Type(), localKey.Type())
+	}
+	localKey.Set(ownerKey.Convert(localKey.Type()))
+	return nil
+}
+
 func (d *DB) withCreate(arg any, with *With, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -176,24 +346,40 @@ func (d *DB) withCreate(arg any, with *With, wg *sync.WaitGroup) {
 		return
 	}
 
+	db := d.ClonePure(1)
+
+	for modelName, funcList := range d.childWiths {
+		db.With(modelName, funcList...)
+	}
+
+	with.Callback(db)
+
+	if with.Type == schema.ManyToMany {
+		foreignKey := argValue.FieldByName(with.LocalKey.Name).Interface()
+		if err := d.savePivots(db, with, foreignKey, withModel, false); err != nil {
+			d.AddError(err)
+		}
+		return
+	}
+
 	if withModel.Kind() == reflect.Slice || withModel.Kind() == reflect.Array {
 		for i := 0; i < withModel.Len(); i++ {
 			foreignKey := withModel.Index(i).FieldByName(with.ForeignKey.Name)
 			foreignKey.Set(argValue.FieldByName(with.LocalKey.Name))
+
+			if with.MorphType != nil {
+				setMorphValue(withModel.Index(i).FieldByName(with.MorphType.Name), with.MorphValue)
+			}
 		}
 	} else {
 		foreignKey := withModel.FieldByName(with.ForeignKey.Name)
 		foreignKey.Set(argValue.FieldByName(with.LocalKey.Name))
-	}
-
-	db := d.ClonePure(1)
 
-	for modelName, funcList := range d.childWiths {
-		db.With(modelName, funcList...)
+		if with.MorphType != nil {
+			setMorphValue(withModel.FieldByName(with.MorphType.Name), with.MorphValue)
+		}
 	}
 
-	with.Callback(db)
-
 	_, err := db.Create(withModel.Addr().Interface())
 
 	if err != nil {
@@ -206,39 +392,73 @@ func (d *DB) Delete(value any, force ...bool) (affected int64, err error) {
 	db := d.getInstance()
 	tableInfo := db.getTableInfo(value)
 
+	// 级联删除需要在同一个事务中完成
+	if db.tx == nil && len(cascadeWiths(tableInfo)) > 0 {
+		err = db.Transaction(func(query *DB) error {
+			affected, err = db.cloneToTx(query).Delete(value, force...)
+			return err
+		})
+		return
+	}
+
 	if model, ok := tableInfo.Value.Addr().Interface().(IBeforeDelete); ok {
 		if err = model.BeforeDelete(db); err != nil {
 			return
 		}
 	}
 
+	if err = db.observeDeleting(tableInfo.Value); err != nil {
+		return
+	}
+
+	if err = db.checkModelTenant(tableInfo); err != nil {
+		return
+	}
+
 	if db.b.GetTable() == "" {
 		db.b.Table(tableInfo.TableName)
 	}
 
-	if len(db.b.GetWhere()) == 0 &&
-		tableInfo.PrimaryKey != nil &&
-		tableInfo.RecordValue(tableInfo.PrimaryKey, db.omitEmpty, true) == true {
-		db.Where(tableInfo.PrimaryKey.FieldName, tableInfo.PrimaryKey.Value)
+	if err = db.applyConditions(tableInfo); err != nil {
+		return
 	}
 
-	if tableInfo.GetField("DeletedAt") != nil &&
-		(len(force) == 0 || force[0] == false) {
-		affected, err = db.softDelete()
-	} else {
-		if len(db.b.GetWhere()) == 0 {
-			return 0, ErrMissingCondition
+	if len(db.b.GetWhere()) == 0 {
+		if primaryKey, ok := primaryKeyValue(tableInfo); ok {
+			db.Where(tableInfo.PrimaryKey.FieldName, primaryKey)
 		}
+	}
 
-		var result sql.Result
+	if len(db.b.GetWhere()) == 0 {
+		return 0, ErrMissingCondition
+	}
 
-		sql, params := db.b.Delete()
+	soft := tableInfo.SoftDelete != nil && (len(force) == 0 || force[0] == false)
 
-		if result, err = db.Exec(sql, params...); err != nil {
-			return
-		}
+	// 软删除只处理未删除的记录，强制删除只有 OnlyTrashed 时才过滤
+	if soft || db.onlyTrashed {
+		db.applySoftDelete(tableInfo, "")
+	}
+	db.applyGlobalScopes(tableInfo, "")
+
+	if err = db.deleteRelations(tableInfo, soft); err != nil {
+		return
+	}
 
-		affected, err = result.RowsAffected()
+	if soft {
+		affected, err = db.softDelete(tableInfo)
+	} else {
+		stmt := &Statement{DB: db, Schema: tableInfo}
+		err = db.callback.Delete().execute(stmt, func() (string, []any, error) {
+			sql, params := db.b.Clone().Delete()
+			return sql, params, nil
+		}, db.execStatement)
+
+		if affected = stmt.RowsAffected; err == nil {
+			if err = db.observeDeleted(tableInfo.Value); err == nil {
+				db.afterCommitDelete(tableInfo.Value)
+			}
+		}
 
 		return
 	}
@@ -253,14 +473,45 @@ func (d *DB) Delete(value any, force ...bool) (affected int64, err error) {
 		}
 	}
 
+	if err1 := db.observeDeleted(tableInfo.Value); err1 != nil {
+		db.AddError(err1)
+	}
+
 	err = db.Error
+	if err == nil {
+		db.afterCommitDelete(tableInfo.Value)
+	}
 	return
 }
 
-func (d *DB) softDelete() (int64, error) {
-	return d.Update(map[string]any{
-		"deleted_at": time.Now().Format("2006-01-02 15:04:05.000"),
-	})
+// softDelete 按软删除字段的处理方式写入删除时间或删除标记，条件中已经执行了全局作用域，不再执行
+func (d *DB) softDelete(tableInfo *schema.Schema) (int64, error) {
+	field := tableInfo.SoftDelete
+	stmt := &Statement{DB: d, Schema: tableInfo, Values: []map[string]any{{field.FieldName: field.DeletedValue()}}}
+
+	err := d.callback.Delete().execute(stmt, d.buildUpdate(stmt), d.execStatement)
+	return stmt.RowsAffected, err
+}
+
+// buildUpdate 按 stmt.Values 生成更新语句，Before 回调可能清空写入的字段
+func (d *DB) buildUpdate(stmt *Statement) func() (string, []any, error) {
+	return func() (string, []any, error) {
+		if len(stmt.Values) == 0 || len(stmt.Values[0]) == 0 {
+			return "", nil, ErrParam
+		}
+		sql, params := d.b.Clone().Update(stmt.Values[0])
+		return sql, params, nil
+	}
+}
+
+// execStatement 执行回调处理后的语句，记录影响的行数
+func (d *DB) execStatement(stmt *Statement) error {
+	result, err := d.exec(stmt.SQL, stmt.Vars...)
+	if err != nil {
+		return err
+	}
+	stmt.RowsAffected, err = result.RowsAffected()
+	return err
 }
 
 func (d *DB) Update(arg any) (affected int64, err error) {
@@ -285,22 +536,26 @@ func (d *DB) Update(arg any) (affected int64, err error) {
 
 		if len(db.withs) > 0 {
 			withs := db.makeWiths(tableInfo)
-			if db.tx == nil {
-				db.Transaction(func(query *DB) error {
-					query = query.ClonePure(1)
-					query.b = db.b
-					affected, err = query.withUpdates(withs, arg)
-					return err
-				})
-				return
-			} else {
-				affected, err = db.withUpdates(withs, arg)
-				return
-			}
+			err = db.Transaction(func(query *DB) error {
+				affected, err = db.cloneToTx(query).withUpdates(withs, arg)
+				return err
+			})
+			return
+		}
+
+		// 更新关联模型时由 withUpdates 再次调用 Update 通知观察者
+		if err = db.observeUpdating(tableInfo.Value); err != nil {
+			return
 		}
 	}
 
+	// 关联条件及之后的条件要先添加，才能判断是否指定了更新条件
+	if err = db.applyConditions(db.schema); err != nil {
+		return
+	}
+
 	var argToMap map[string]any
+	var version reflect.Value
 
 	switch kind {
 	case reflect.Struct:
@@ -309,15 +564,20 @@ func (d *DB) Update(arg any) (affected int64, err error) {
 		}
 
 		argToMap = tableInfo.RecordValues(db.omitEmpty, true)
+		if err = db.fillTenant(tableInfo, argToMap); err != nil {
+			return
+		}
 
 		if len(d.b.GetWhere()) == 0 {
-			if tableInfo.PrimaryKey == nil ||
-				tableInfo.PrimaryKey.Value == nil ||
-				reflect.ValueOf(tableInfo.PrimaryKey.Value).IsZero() {
+			primaryKey, ok := primaryKeyValue(tableInfo)
+			if !ok {
 				return 0, ErrMissingCondition
-			} else {
-				db.Where(tableInfo.PrimaryKey.FieldName, tableInfo.PrimaryKey.Value)
 			}
+			db.Where(tableInfo.PrimaryKey.FieldName, primaryKey)
+		}
+
+		if tableInfo.Version != nil {
+			version = db.lockVersion(tableInfo, argToMap)
 		}
 	case reflect.Map:
 		ok := false
@@ -336,13 +596,27 @@ func (d *DB) Update(arg any) (affected int64, err error) {
 		return 0, ErrParam
 	}
 
-	sql, params := db.b.Update(argToMap)
+	if kind == reflect.Map {
+		if _, err = db.checkTenantValues(db.schema, argToMap, false); err != nil {
+			return
+		}
+	}
+
+	db.applyScopes(db.schema, "")
 
-	result, err := db.Exec(sql, params...)
-	if err != nil {
+	stmt := &Statement{DB: db, Schema: db.schema, Values: []map[string]any{argToMap}}
+	if err = db.callback.Update().execute(stmt, db.buildUpdate(stmt), db.execStatement); err != nil {
 		return 0, err
 	}
 
+	// 记录存在但版本号不一致说明已经被其他人修改
+	if version.IsValid() {
+		if stmt.RowsAffected == 0 {
+			return 0, db.versionError(tableInfo)
+		}
+		tableInfo.Value.FieldByName(tableInfo.Version.Name).Set(version)
+	}
+
 	if tableInfo != nil {
 		if model, ok := tableInfo.Value.Addr().Interface().(IAfterUpdate); ok {
 			err = model.AfterUpdate(db)
@@ -350,9 +624,15 @@ func (d *DB) Update(arg any) (affected int64, err error) {
 				return
 			}
 		}
+
+		if err = db.observeUpdated(tableInfo.Value); err != nil {
+			return
+		}
+
+		db.afterCommitUpdate(tableInfo.Value)
 	}
 
-	return result.RowsAffected()
+	return stmt.RowsAffected, nil
 }
 
 func (d *DB) withUpdates(withs []*With, arg any) (i int64, err error) {
@@ -399,12 +679,16 @@ func (d *DB) withUpdate(with *With, argValue reflect.Value, wg *sync.WaitGroup)
 		return
 	}
 
-	if with.Type == schema.One {
+	if with.Type == schema.One || with.Type == schema.BelongsTo || with.Type == schema.MorphOne {
 		val := argValue.FieldByName(with.LocalKey.Name)
 		if val.IsZero() {
 			return
 		}
 
+		if with.Type == schema.MorphOne {
+			db.Where(with.MorphType.FieldName, with.MorphValue)
+		}
+
 		_, err := db.Where(with.ForeignKey.FieldName, val.Interface()).
 			Update(withModel.Addr().Interface())
 
@@ -412,4 +696,16 @@ func (d *DB) withUpdate(with *With, argValue reflect.Value, wg *sync.WaitGroup)
 			d.AddError(err)
 		}
 	}
+
+	// 多对多关联以传入的关联模型为准同步中间表
+	if with.Type == schema.ManyToMany {
+		val := argValue.FieldByName(with.LocalKey.Name)
+		if val.IsZero() {
+			return
+		}
+
+		if err := d.savePivots(db, with, val.Interface(), withModel, true); err != nil {
+			d.AddError(err)
+		}
+	}
 }
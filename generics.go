@@ -0,0 +1,171 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Query 泛型查询，在 DB 之上提供类型安全的查询方法，复用 DB 的解析与钩子
+type Query[T any] struct {
+	db *DB
+	// err T 不是结构体时的错误，执行查询时返回
+	err error
+}
+
+// Q 创建泛型查询，T 必须是模型结构体，不能是指针，否则执行查询时返回 ErrParam
+//
+//	user, err := orm.Q[User](db).Where("user_name", "kwin").First()
+func Q[T any](db *DB) *Query[T] {
+	q := &Query[T]{db: db}
+	if modelType := reflect.TypeOf((*T)(nil)).Elem(); modelType.Kind() != reflect.Struct {
+		q.err = fmt.Errorf("%w: Q[%s] requires a struct type", ErrParam, modelType)
+	}
+	return q
+}
+
+func (q *Query[T]) chain(db *DB) *Query[T] {
+	return &Query[T]{db: db, err: q.err}
+}
+
+// DB 返回底层的 *DB，用于调用泛型查询未封装的方法
+func (q *Query[T]) DB() *DB {
+	return q.db
+}
+
+func (q *Query[T]) Select(args ...any) *Query[T] {
+	return q.chain(q.db.Select(args...))
+}
+
+func (q *Query[T]) Omit(field ...string) *Query[T] {
+	return q.chain(q.db.Omit(field...))
+}
+
+func (q *Query[T]) Where(args ...any) *Query[T] {
+	return q.chain(q.db.Where(args...))
+}
+
+func (q *Query[T]) OrWhere(args ...any) *Query[T] {
+	return q.chain(q.db.OrWhere(args...))
+}
+
+func (q *Query[T]) WhereIn(field string, value ...any) *Query[T] {
+	return q.chain(q.db.WhereIn(field, value...))
+}
+
+func (q *Query[T]) WhereNotIn(field string, value ...any) *Query[T] {
+	return q.chain(q.db.WhereNotIn(field, value...))
+}
+
+func (q *Query[T]) WhereNull(field string) *Query[T] {
+	return q.chain(q.db.WhereNull(field))
+}
+
+func (q *Query[T]) WhereNotNull(field string) *Query[T] {
+	return q.chain(q.db.WhereNotNull(field))
+}
+
+func (q *Query[T]) WhereBetween(field string, value ...any) *Query[T] {
+	return q.chain(q.db.WhereBetween(field, value...))
+}
+
+func (q *Query[T]) Group(group ...string) *Query[T] {
+	return q.chain(q.db.Group(group...))
+}
+
+func (q *Query[T]) Having(args ...any) *Query[T] {
+	return q.chain(q.db.Having(args...))
+}
+
+func (q *Query[T]) Order(args ...any) *Query[T] {
+	return q.chain(q.db.Order(args...))
+}
+
+func (q *Query[T]) Limit(args ...int64) *Query[T] {
+	return q.chain(q.db.Limit(args...))
+}
+
+func (q *Query[T]) Page(page int64, listRows int64) *Query[T] {
+	return q.chain(q.db.Page(page, listRows))
+}
+
+func (q *Query[T]) With(name string, callbacks ...WithFunc) *Query[T] {
+	return q.chain(q.db.With(name, callbacks...))
+}
+
+func (q *Query[T]) WithDelete() *Query[T] {
+	return q.chain(q.db.WithDelete())
+}
+
+// First 查询第一条记录
+func (q *Query[T]) First() (T, error) {
+	var value T
+	if q.err != nil {
+		return value, q.err
+	}
+	err := q.db.First(&value)
+	return value, err
+}
+
+// Find 根据主键查询
+func (q *Query[T]) Find(id int64) (T, error) {
+	var value T
+	if q.err != nil {
+		return value, q.err
+	}
+	err := q.db.Find(&value, id)
+	return value, err
+}
+
+// All 查询所有记录，没有记录时返回空切片
+func (q *Query[T]) All() ([]T, error) {
+	values := make([]T, 0)
+	if q.err != nil {
+		return values, q.err
+	}
+	err := q.db.Get(&values)
+	if err == ErrNotFind {
+		err = nil
+	}
+	return values, err
+}
+
+// Count 统计记录数
+func (q *Query[T]) Count() (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	var value T
+	return q.db.Model(&value).Count()
+}
+
+// Create 创建记录，自增主键会回写到结构体中
+func (q *Query[T]) Create(values ...*T) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if len(values) == 0 {
+		return 0, ErrParam
+	}
+
+	args := make([]any, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return q.db.Create(args...)
+}
+
+// Update 根据主键或已有条件更新记录
+func (q *Query[T]) Update(value *T) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	return q.db.Update(value)
+}
+
+// Delete 根据主键或已有条件删除记录
+func (q *Query[T]) Delete(value *T, force ...bool) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	return q.db.Delete(value, force...)
+}
@@ -5,5 +5,6 @@ go 1.21
 require (
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/kwinh/go-sql-builder v1.0.6
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.17
 )
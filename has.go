@@ -0,0 +1,157 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	sqlBuilder "github.com/kwinh/go-sql-builder"
+	"strings"
+)
+
+// Has 只查询至少有一条关联数据的记录，name 支持 "Orders.Items" 嵌套关联
+//
+//	SELECT * FROM `user` WHERE EXISTS (SELECT 1 FROM `order` WHERE `order`.`user_id` = `user`.`id`)
+func (d *DB) Has(name string) *DB {
+	return d.whereHas("EXISTS", false, name, nil)
+}
+
+// WhereHas 只查询有满足 callback 条件的关联数据的记录，嵌套关联时 callback 作用于最后一级关联
+func (d *DB) WhereHas(name string, callback WithFunc) *DB {
+	return d.whereHas("EXISTS", false, name, callback)
+}
+
+// OrWhereHas 以 OR 连接的 WhereHas
+func (d *DB) OrWhereHas(name string, callback WithFunc) *DB {
+	return d.whereHas("EXISTS", true, name, callback)
+}
+
+// DoesntHave 只查询没有关联数据的记录
+func (d *DB) DoesntHave(name string) *DB {
+	return d.whereHas("NOT EXISTS", false, name, nil)
+}
+
+// WhereDoesntHave 只查询没有满足 callback 条件的关联数据的记录
+func (d *DB) WhereDoesntHave(name string, callback WithFunc) *DB {
+	return d.whereHas("NOT EXISTS", false, name, callback)
+}
+
+// whereHas 关联条件依赖模型的 schema，等到执行时再生成子查询，之后添加的条件也推迟到执行时按调用顺序添加
+func (d *DB) whereHas(operator string, or bool, name string, callback WithFunc) *DB {
+	db := d.getInstance()
+
+	db.conditions = append(db.conditions, func(db *DB, tableInfo *schema.Schema) {
+		table := tableInfo.TableName
+		if db.b.TableAlias != "" {
+			table = db.b.TableAlias
+		}
+
+		query, err := db.relationQuery(tableInfo, table, strings.Split(name, "."), callback, sqlBuilder.Raw("1"))
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+
+		if or {
+			db.b.OrWhere(operator, query)
+		} else {
+			db.b.Where(operator, query)
+		}
+	})
+
+	return db
+}
+
+// relationQuery 生成与外层查询关联的子查询，table 为外层查询的表名或别名，field 为子查询的查询字段
+func (d *DB) relationQuery(tableInfo *schema.Schema, table string, names []string, callback WithFunc, field sqlBuilder.Raw) (func(*sqlBuilder.Builder), error) {
+	with, ok := tableInfo.Withs[names[0]]
+	if ok {
+		with = with.ResolveThrough()
+	}
+	if with == nil {
+		return nil, fmt.Errorf("%w: %s.%s", ErrMissingRelation, tableInfo.Name, names[0])
+	}
+
+	// morphTo 关联的表由类型字段决定，无法生成子查询
+	if with.Type == schema.MorphTo {
+		return nil, fmt.Errorf("%w: %s.%s", ErrRelationType, tableInfo.Name, names[0])
+	}
+
+	relatedTable := relationTable(tableInfo, with, table)
+
+	db := d.ClonePure(1)
+	db.withDel = false
+	if relatedTable != with.Schema.TableName {
+		db.b.Table(with.Schema.TableName + " as " + relatedTable).Select(field)
+	} else {
+		db.b.Table(relatedTable).Select(field)
+	}
+
+	// 远程关联与多对多关联一样，通过 JOIN 中间表关联当前模型
+	if with.Type == schema.ManyToMany || with.Type == schema.HasOneThrough || with.Type == schema.HasManyThrough {
+		db.b.Join(with.JoinTable, fmt.Sprintf("ON `%s`.`%s` = `%s`.`%s`",
+			with.JoinTable, with.JoinReferences, relatedTable, with.ForeignKey.FieldName))
+		db.b.Where(sqlBuilder.Raw(fmt.Sprintf("`%s`.`%s` = `%s`.`%s`",
+			with.JoinTable, with.JoinForeignKey, table, with.LocalKey.FieldName)))
+	} else {
+		db.b.Where(sqlBuilder.Raw(fmt.Sprintf("`%s`.`%s` = `%s`.`%s`",
+			relatedTable, with.ForeignKey.FieldName, table, with.LocalKey.FieldName)))
+	}
+
+	if with.MorphType != nil {
+		db.b.Where(relatedTable+"."+with.MorphType.FieldName, schema.MorphName(tableInfo))
+	}
+
+	if len(names) > 1 {
+		query, err := db.relationQuery(with.Schema, relatedTable, names[1:], callback, sqlBuilder.Raw("1"))
+		if err != nil {
+			return nil, err
+		}
+		db.b.WhereExists(query)
+	} else if callback != nil {
+		callback(db)
+		if err := db.applyConditions(with.Schema); err != nil {
+			return nil, err
+		}
+	}
+
+	db.applyScopes(with.Schema, relatedTable)
+	db.applyScopes(with.Through, with.JoinTable)
+
+	if db.Error != nil {
+		return nil, db.Error
+	}
+
+	// Builder.Clone 不会复制表的别名
+	return func(b *sqlBuilder.Builder) {
+		*b = *db.b.Clone()
+		b.TableAlias = db.b.TableAlias
+	}, nil
+}
+
+// relationTable 子查询中关联表的名称，关联自身的模型（例如 Category.Parent）与外层查询是同一张表，
+// 使用 orm_reserved_N 作为别名，避免关联条件引用到子查询自身的表
+func relationTable(tableInfo *schema.Schema, with *schema.With, table string) string {
+	if with.Schema.TableName != tableInfo.TableName && with.Schema.TableName != table {
+		return with.Schema.TableName
+	}
+
+	for i := 0; ; i++ {
+		if alias := fmt.Sprintf("orm_reserved_%d", i); alias != table {
+			return alias
+		}
+	}
+}
+
+// applyConditions 执行依赖模型 schema 的条件，执行后清空，避免重复添加
+func (d *DB) applyConditions(tableInfo *schema.Schema) error {
+	conditions := d.conditions
+	d.conditions = nil
+
+	if len(conditions) > 0 && tableInfo == nil {
+		return ErrMissingModel
+	}
+
+	for _, condition := range conditions {
+		condition(d, tableInfo)
+	}
+	return d.Error
+}
@@ -1,5 +1,10 @@
 package orm
 
+// IGlobalScopes 全局作用域，键为作用域名称，查询、统计、更新、删除时自动执行，可以用 WithoutGlobalScope 跳过
+type IGlobalScopes interface {
+	GlobalScopes() map[string]ScopeFunc
+}
+
 // IGetAttr 访问器
 type IGetAttr interface {
 	GetAttr()
@@ -49,3 +54,63 @@ type IBeforeDelete interface {
 type IAfterDelete interface {
 	AfterDelete(*DB) error
 }
+
+// IAfterCommitCreate 创建后所在的事务提交时执行的钩子，不在事务中时创建后立即执行
+type IAfterCommitCreate interface {
+	AfterCommitCreate(*DB)
+}
+
+// IAfterCommitUpdate 修改后所在的事务提交时执行的钩子，不在事务中时修改后立即执行
+type IAfterCommitUpdate interface {
+	AfterCommitUpdate(*DB)
+}
+
+// IAfterCommitDelete 删除后所在的事务提交时执行的钩子，不在事务中时删除后立即执行
+type IAfterCommitDelete interface {
+	AfterCommitDelete(*DB)
+}
+
+// ISavingObserver 观察者，模型创建、修改前执行，在 Creating、Updating 之前
+type ISavingObserver interface {
+	Saving(db *DB, model any) error
+}
+
+// ISavedObserver 观察者，模型创建、修改后执行，在 Created、Updated 之后
+type ISavedObserver interface {
+	Saved(db *DB, model any) error
+}
+
+// ICreatingObserver 观察者，模型创建前执行
+type ICreatingObserver interface {
+	Creating(db *DB, model any) error
+}
+
+// ICreatedObserver 观察者，模型创建后执行
+type ICreatedObserver interface {
+	Created(db *DB, model any) error
+}
+
+// IUpdatingObserver 观察者，模型修改前执行
+type IUpdatingObserver interface {
+	Updating(db *DB, model any) error
+}
+
+// IUpdatedObserver 观察者，模型修改后执行
+type IUpdatedObserver interface {
+	Updated(db *DB, model any) error
+}
+
+// IDeletingObserver 观察者，模型删除前执行
+type IDeletingObserver interface {
+	Deleting(db *DB, model any) error
+}
+
+// IDeletedObserver 观察者，模型删除后执行
+type IDeletedObserver interface {
+	Deleted(db *DB, model any) error
+}
+
+// IRetrievedObserver 观察者，查询出模型后执行
+type IRetrievedObserver interface {
+	Retrieved(db *DB, model any) error
+}
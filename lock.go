@@ -0,0 +1,62 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"sync"
+)
+
+// lockUnsupported 已经提示过不支持行锁的方言，每种方言只提示一次
+var lockUnsupported sync.Map
+
+// LockForUpdate 查询时加排他锁，需要在事务中使用，sqlite 不支持行锁，不会生成加锁子句
+//
+//	SELECT * FROM `product` WHERE `id` = 1 FOR UPDATE
+func (d *DB) LockForUpdate() *DB {
+	db := d.getInstance()
+	db.lockStrength = schema.LockUpdate
+	return db
+}
+
+// SharedLock 查询时加共享锁，需要在事务中使用，sqlite 不支持行锁，不会生成加锁子句
+//
+//	SELECT * FROM `product` WHERE `id` = 1 LOCK IN SHARE MODE
+func (d *DB) SharedLock() *DB {
+	db := d.getInstance()
+	db.lockStrength = schema.LockShare
+	return db
+}
+
+// SkipLocked 跳过已经被其他事务锁定的行，与 LockForUpdate、SharedLock 一起使用
+func (d *DB) SkipLocked() *DB {
+	db := d.getInstance()
+	db.lockOption = schema.LockSkipLocked
+	return db
+}
+
+// NoWait 行已经被其他事务锁定时不等待，直接返回错误，与 LockForUpdate、SharedLock 一起使用
+func (d *DB) NoWait() *DB {
+	db := d.getInstance()
+	db.lockOption = schema.LockNoWait
+	return db
+}
+
+// lockClause 根据方言生成加锁子句，不在事务中时锁会在语句结束后立即释放；
+// 方言没有实现 schema.ILock 时不加锁，第一次使用时输出提示
+func (d *DB) lockClause() string {
+	if d.lockStrength == "" {
+		return ""
+	}
+
+	lock, ok := d.dialector.(schema.ILock)
+	if !ok {
+		if _, logged := lockUnsupported.LoadOrStore(d.dialector.Name(), true); !logged {
+			d.Logger.Info("%s does not support row locks, lock %s is ignored", d.dialector.Name(), d.lockStrength)
+		}
+		return ""
+	}
+
+	if d.tx == nil {
+		d.Logger.Info("lock %s is used outside transaction", d.lockStrength)
+	}
+	return lock.Lock(d.lockStrength, d.lockOption)
+}
@@ -5,9 +5,16 @@ import (
 	"time"
 )
 
+// Model 嵌入到模型中提供自增主键 Id、创建时间、更新时间和软删除字段，
+// 字段选项写在 orm 标签中，解析模型时只读取 orm 标签
 type Model struct {
-	Id        uint `db:"autoIncrement"`
+	Id        uint `orm:"autoIncrement"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt sql.NullTime `db:"index"`
+	DeletedAt sql.NullTime `orm:"index"`
+}
+
+// IsTrashed 记录是否已被软删除，只检查 DeletedAt，模型用 softDelete 标签声明了其它软删除字段时使用 DB.IsTrashed
+func (m Model) IsTrashed() bool {
+	return m.DeletedAt.Valid
 }
@@ -0,0 +1,134 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+// morphKey morphTo 关联的关联键，同一个 id 在不同类型的模型中对应不同的记录
+type morphKey struct {
+	name string
+	key  any
+}
+
+// RegisterMorph 注册多态关联类型字段的值对应的模型，morphTo 关联根据类型字段查询对应的模型，
+// 注册后 morphOne、morphMany 关联写入的类型字段也使用 name，没有注册时为表名
+//
+//	orm.RegisterMorph("post", &Post{})
+func RegisterMorph(name string, model any) {
+	schema.RegisterMorph(name, model)
+}
+
+// setMorphToRelationships morphTo 关联：按类型字段分组，每种模型执行一次查询
+func (d *DB) setMorphToRelationships(with *With) {
+	groups := make(map[string][]any)
+	names := make([]string, 0)
+	for _, value := range with.Values {
+		key := value.(morphKey)
+		if _, ok := groups[key.name]; !ok {
+			names = append(names, key.name)
+		}
+		groups[key.name] = append(groups[key.name], key.key)
+	}
+
+	for _, name := range names {
+		modelType, ok := schema.MorphModel(name)
+		if !ok {
+			d.AddError(fmt.Errorf("%w: %s", ErrMissingMorph, name))
+			return
+		}
+
+		tableInfo := schema.Parse(reflect.New(modelType).Interface(), d.dialector, d.TablePrefix)
+		if tableInfo.PrimaryKey == nil {
+			d.AddError(fmt.Errorf("%w: %s", ErrMissingCondition, name))
+			return
+		}
+
+		joinResults := schema.MakeSlice(modelType).Elem()
+
+		db := d.ClonePure(1)
+
+		// 嵌套关联作用于每一种模型，模型上没有的关联会被忽略
+		for modelName, funcList := range d.childWiths {
+			db.With(modelName, funcList...)
+		}
+
+		with.Callback(db)
+		err := db.Where(tableInfo.PrimaryKey.FieldName, "in", groups[name]).Get(joinResults.Addr().Interface())
+
+		if err != nil {
+			if err != ErrNotFind {
+				d.AddError(err)
+			}
+			continue
+		}
+
+		keyType := with.LocalKey.StructField.Type
+		for i := 0; i < joinResults.Len(); i++ {
+			val := joinResults.Index(i)
+			mk := morphKey{name: name, key: relationKey(val.FieldByName(tableInfo.PrimaryKey.Name), keyType)}
+			with.Relationships[mk] = append(with.Relationships[mk], val)
+		}
+	}
+}
+
+// setMorphTo 把关联模型写入 morphTo 字段，字段的接口类型由模型指针实现时写入指针
+func setMorphTo(field reflect.Value, model reflect.Value) {
+	ptr := reflect.New(model.Type())
+	ptr.Elem().Set(model)
+
+	switch {
+	case ptr.Type().AssignableTo(field.Type()):
+		field.Set(ptr)
+	case model.Type().AssignableTo(field.Type()):
+		field.Set(model)
+	}
+}
+
+// withCreateMorphOwner morphTo 关联先创建关联模型，再写入当前模型的关联键和类型字段，
+// 字段中需要是模型的指针
+func (d *DB) withCreateMorphOwner(arg any, with *With) error {
+	argValue := reflect.ValueOf(arg).Elem()
+	field := argValue.FieldByName(with.Name)
+
+	if field.IsNil() {
+		return nil
+	}
+
+	ownerValue := field.Elem()
+	if ownerValue.Kind() != reflect.Ptr || ownerValue.Elem().Kind() != reflect.Struct {
+		return ErrParam
+	}
+
+	tableInfo := schema.Parse(ownerValue.Interface(), d.dialector, d.TablePrefix)
+	if tableInfo.PrimaryKey == nil {
+		return ErrMissingCondition
+	}
+
+	ownerModel := ownerValue.Elem()
+	if ownerModel.FieldByName(tableInfo.PrimaryKey.Name).IsZero() {
+		db := d.ClonePure(1)
+
+		for modelName, funcList := range d.childWiths {
+			db.With(modelName, funcList...)
+		}
+
+		with.Callback(db)
+
+		if _, err := db.Create(ownerValue.Interface()); err != nil {
+			return err
+		}
+	}
+
+	localKey := argValue.FieldByName(with.LocalKey.Name)
+	localKey.Set(ownerModel.FieldByName(tableInfo.PrimaryKey.Name).Convert(localKey.Type()))
+
+	setMorphValue(argValue.FieldByName(with.MorphType.Name), schema.MorphName(tableInfo))
+	return nil
+}
+
+// setMorphValue 写入多态关联的类型字段
+func setMorphValue(field reflect.Value, name string) {
+	field.Set(reflect.ValueOf(name).Convert(field.Type()))
+}
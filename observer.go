@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+	"sync"
+)
+
+// observers 按模型类型注册的观察者
+type observers struct {
+	mu        sync.RWMutex
+	observers map[reflect.Type][]any
+}
+
+func newObservers() *observers {
+	return &observers{observers: make(map[reflect.Type][]any)}
+}
+
+// Observe 为模型注册观察者，observer 实现 ICreatingObserver、ISavedObserver 等任意观察者接口，
+// 适用于不能添加钩子方法的模型，和模型钩子一起执行，同一个模型的观察者按注册顺序执行
+//
+//	db.Observe(&User{}, UserObserver{})
+func (d *DB) Observe(model any, observer any) {
+	if d.observers == nil {
+		return
+	}
+
+	modelType := schema.Parse(model, d.dialector, d.TablePrefix).Type
+
+	d.observers.mu.Lock()
+	defer d.observers.mu.Unlock()
+	d.observers.observers[modelType] = append(d.observers.observers[modelType], observer)
+}
+
+// observe 依次通知模型的观察者，value 为模型结构体，有观察者返回错误时停止
+func (d *DB) observe(value reflect.Value, notify func(observer any, model any) error) error {
+	if d.observers == nil {
+		return nil
+	}
+
+	d.observers.mu.RLock()
+	list := d.observers.observers[value.Type()]
+	d.observers.mu.RUnlock()
+
+	for _, observer := range list {
+		if err := notify(observer, value.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeCreating 创建前执行 Saving、Creating
+func (d *DB) observeCreating(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(ISavingObserver); ok {
+			if err := o.Saving(d, model); err != nil {
+				return err
+			}
+		}
+		if o, ok := observer.(ICreatingObserver); ok {
+			return o.Creating(d, model)
+		}
+		return nil
+	})
+}
+
+// observeCreated 创建后执行 Created、Saved
+func (d *DB) observeCreated(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(ICreatedObserver); ok {
+			if err := o.Created(d, model); err != nil {
+				return err
+			}
+		}
+		if o, ok := observer.(ISavedObserver); ok {
+			return o.Saved(d, model)
+		}
+		return nil
+	})
+}
+
+// observeUpdating 修改前执行 Saving、Updating
+func (d *DB) observeUpdating(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(ISavingObserver); ok {
+			if err := o.Saving(d, model); err != nil {
+				return err
+			}
+		}
+		if o, ok := observer.(IUpdatingObserver); ok {
+			return o.Updating(d, model)
+		}
+		return nil
+	})
+}
+
+// observeUpdated 修改后执行 Updated、Saved
+func (d *DB) observeUpdated(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(IUpdatedObserver); ok {
+			if err := o.Updated(d, model); err != nil {
+				return err
+			}
+		}
+		if o, ok := observer.(ISavedObserver); ok {
+			return o.Saved(d, model)
+		}
+		return nil
+	})
+}
+
+func (d *DB) observeDeleting(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(IDeletingObserver); ok {
+			return o.Deleting(d, model)
+		}
+		return nil
+	})
+}
+
+func (d *DB) observeDeleted(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(IDeletedObserver); ok {
+			return o.Deleted(d, model)
+		}
+		return nil
+	})
+}
+
+func (d *DB) observeRetrieved(value reflect.Value) error {
+	return d.observe(value, func(observer any, model any) error {
+		if o, ok := observer.(IRetrievedObserver); ok {
+			return o.Retrieved(d, model)
+		}
+		return nil
+	})
+}
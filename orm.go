@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/kwinh/go-orm/drive"
@@ -20,22 +21,49 @@ type Config struct {
 	dialector   schema.IDialect
 	Migrate     schema.IMigrator
 	Logger      logger.ILogger
+	callback    *Callbacks
+	observers   *observers
+	// TenantColumn 多租户字段，模型有这个字段时自动按当前租户过滤和填充，为空时不开启多租户；
+	// 只对能确定模型的操作生效，只用 Table 指定表名（没有 Model）的查询、更新、删除以及 Exec、Query、Raw 不会限定租户，
+	// Model(x).Update(map) 会限定租户并检查 map 中的租户字段
+	TenantColumn string
+	// TenantResolver 从 context 中取得当前租户，没有设置时使用 ContextWithTenant 写入的租户
+	TenantResolver func(ctx context.Context) (any, bool)
 }
 
 type DB struct {
 	*Config
-	tx *sql.Tx
+	tx  *sql.Tx
+	ctx context.Context
+	// savepoint 嵌套事务创建的保存点，savepoints 为同一个事务中保存点的计数
+	savepoint  string
+	savepoints *int64
+	// callbacks 事务提交、回滚后执行的回调
+	callbacks *txCallbacks
 
 	omitField  map[string]bool
 	b          sqlBuilder.Builder
 	schema     *schema.Schema
 	withs      map[string]WithFunc
 	childWiths map[string][]WithFunc
+	conditions []func(*DB, *schema.Schema)
+	aggregates []withAggregate
 	clone      int
 	Error      error
 	sql        string
 	bindings   []any
 	withDel    bool
+	// onlyTrashed 只查询软删除的记录，不会传递给关联查询
+	onlyTrashed bool
+	// withoutScopes 跳过的全局作用域，不会传递给关联查询
+	withoutScopes map[string]bool
+	// tenant WithTenant 指定的租户
+	tenant any
+	// lockStrength、lockOption 查询时的行锁，不会传递给关联查询
+	lockStrength schema.LockStrength
+	lockOption   schema.LockOption
+	// onConflict Upsert 的冲突处理方式
+	onConflict *OnConflict
 	omitEmpty  bool
 	startTime  time.Time
 	tableAlias string
@@ -51,6 +79,14 @@ func Open(dialector schema.IDialect, c ...*Config) (db *DB, err error) {
 
 	config.dialector = dialector
 
+	if config.callback == nil {
+		config.callback = newCallbacks()
+	}
+
+	if config.observers == nil {
+		config.observers = newObservers()
+	}
+
 	if config.Logger == nil {
 		config.Logger = logger.Logger{
 			LogLevel: logger.Trace,
@@ -79,50 +115,104 @@ func (d *DB) AddError(err error) error {
 	return d.Error
 }
 
+// WithContext 设置执行语句时使用的 context，用于取消查询、设置超时
+func (d *DB) WithContext(ctx context.Context) *DB {
+	db := d.getInstance()
+	db.ctx = ctx
+	return db
+}
+
+// Context 返回当前使用的 context，未设置时为 context.Background()
+func (d *DB) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// Exec 执行语句，会执行 Callback().Raw() 注册的回调
 func (d *DB) Exec(query string, args ...any) (res sql.Result, err error) {
 	db := d.getInstance()
 
+	stmt := &Statement{DB: db}
+	err = db.Callback().Raw().execute(stmt, func() (string, []any, error) {
+		return query, args, nil
+	}, func(stmt *Statement) error {
+		if res, err = db.exec(stmt.SQL, stmt.Vars...); err != nil {
+			return err
+		}
+		stmt.RowsAffected, _ = res.RowsAffected()
+		return nil
+	})
+	return
+}
+
+// Query 执行查询，会执行 Callback().Row() 注册的回调
+func (d *DB) Query(query string, args ...any) (res *sql.Rows, err error) {
+	db := d.getInstance()
+
+	stmt := &Statement{DB: db}
+	err = db.Callback().Row().execute(stmt, func() (string, []any, error) {
+		return query, args, nil
+	}, func(stmt *Statement) error {
+		res, err = db.query(stmt.SQL, stmt.Vars...)
+		return err
+	})
+	return
+}
+
+func (d *DB) exec(query string, args ...any) (res sql.Result, err error) {
+	db := d.getInstance()
+
 	var stmt *sql.Stmt
 	if db.tx != nil {
-		stmt, err = db.tx.Prepare(query)
+		stmt, err = db.tx.PrepareContext(db.Context(), db.rebind(query))
 	} else {
-		stmt, err = db.connPool.Prepare(query)
+		stmt, err = db.connPool.PrepareContext(db.Context(), db.rebind(query))
 	}
 
 	if err != nil {
-		fmt.Printf("prepare failed, err:%v\n", err)
+		db.Logger.Error("%s %v", query, err)
 		return
 	}
 	defer stmt.Close()
 
-	res, err = stmt.Exec(args...)
+	res, err = stmt.ExecContext(db.Context(), args...)
 
 	db.Logger.Trace(query, args, db.startTime)
 	return
 }
 
-func (d *DB) Query(query string, args ...any) (res *sql.Rows, err error) {
+func (d *DB) query(query string, args ...any) (res *sql.Rows, err error) {
 	db := d.getInstance()
 
-	var stmt *sql.Stmt
+	// 事务中预处理的语句关闭时会立即释放，rows 尚未读取就失效，因此直接查询
 	if db.tx != nil {
-		stmt, err = db.tx.Prepare(query)
-	} else {
-		stmt, err = db.connPool.Prepare(query)
+		res, err = db.tx.QueryContext(db.Context(), db.rebind(query), args...)
+		db.Logger.Trace(query, args, db.startTime)
+		return
 	}
 
+	stmt, err := db.connPool.PrepareContext(db.Context(), db.rebind(query))
 	if err != nil {
 		return
 	}
 	defer stmt.Close()
 
-	res, err = stmt.Query(args...)
+	res, err = stmt.QueryContext(db.Context(), args...)
 
 	db.Logger.Trace(query, args, db.startTime)
 
 	return
 }
 
+func (d *DB) rebind(query string) string {
+	if rebind, ok := d.dialector.(schema.IRebind); ok {
+		return rebind.Rebind(query)
+	}
+	return query
+}
+
 func (d *DB) resetClone() {
 	d.clone = 0
 }
@@ -131,12 +221,25 @@ func (d *DB) Clone() *DB {
 	db := &DB{
 		Config: d.Config,
 		tx:     d.tx,
+		ctx:    d.ctx,
+
+		savepoint:  d.savepoint,
+		savepoints: d.savepoints,
+		callbacks:  d.callbacks,
 
 		b:         *d.b.Clone(),
 		schema:    d.schema,
 		clone:     d.clone,
 		withDel:   d.withDel,
 		omitEmpty: d.omitEmpty,
+		tenant:    d.tenant,
+
+		onlyTrashed:   d.onlyTrashed,
+		withoutScopes: d.withoutScopes,
+		lockStrength:  d.lockStrength,
+		lockOption:    d.lockOption,
+		conditions:    append([]func(*DB, *schema.Schema){}, d.conditions...),
+		aggregates:    append([]withAggregate{}, d.aggregates...),
 	}
 
 	db.withs = make(map[string]WithFunc)
@@ -164,11 +267,16 @@ func (d *DB) ClonePure(clones ...int) *DB {
 		clone = clones[0]
 	}
 	db := &DB{
-		Config:    d.Config,
-		tx:        d.tx,
-		clone:     clone,
-		withDel:   d.withDel,
-		omitEmpty: d.omitEmpty,
+		Config:     d.Config,
+		tx:         d.tx,
+		ctx:        d.ctx,
+		savepoint:  d.savepoint,
+		savepoints: d.savepoints,
+		callbacks:  d.callbacks,
+		clone:      clone,
+		withDel:    d.withDel,
+		omitEmpty:  d.omitEmpty,
+		tenant:     d.tenant,
 	}
 
 	if clone == 1 {
@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"github.com/kwinh/go-orm/drive/mysql"
+	"github.com/kwinh/go-orm/schema"
 	"strings"
 	"testing"
 )
@@ -42,6 +43,18 @@ func init() {
 	}
 }
 
+func TestModel_Schema(t *testing.T) {
+	tableInfo := schema.Parse(&User{}, orm.dialector, orm.TablePrefix)
+	if tableInfo.PrimaryKey == nil || tableInfo.PrimaryKey.Name != "Id" {
+		t.Fatalf("primary key %v", tableInfo.PrimaryKey)
+	}
+
+	// DeletedAt 的选项同样从 orm 标签读取
+	if _, ok := tableInfo.GetField("DeletedAt").TagSettings["index"]; !ok {
+		t.Error("deleted_at without index")
+	}
+}
+
 func TestDB_Migrate(t *testing.T) {
 	value := User{}
 
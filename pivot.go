@@ -0,0 +1,276 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+// pivot 中间表的一条记录
+type pivot struct {
+	foreignKey any
+	reference  any
+	data       reflect.Value
+}
+
+// pivotSchema 关联模型上声明了 `orm:"pivot"` 字段时，返回该字段结构体的 schema
+func (d *DB) pivotSchema(with *With) *schema.Schema {
+	if with.Schema.PivotField == "" {
+		return nil
+	}
+
+	field, ok := with.ModelType.FieldByName(with.Schema.PivotField)
+	if !ok || field.Type.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return schema.Parse(reflect.New(field.Type).Interface(), d.dialector, d.TablePrefix)
+}
+
+// getPivots 查询 foreignKeys 对应的中间表记录
+func (d *DB) getPivots(with *With, foreignKeys []any) (pivots []pivot, err error) {
+	pivotSchema := d.pivotSchema(with)
+
+	db := d.ClonePure(1)
+	fields := []any{with.JoinForeignKey, with.JoinReferences}
+	if pivotSchema != nil {
+		fields = append(append([]any{}, pivotSchema.FieldNames...), fields...)
+	}
+
+	db.b.Table(with.JoinTable).Select(fields...).Where(with.JoinForeignKey, "in", foreignKeys)
+	db.sql, db.bindings = db.b.ToSql()
+
+	rows, err := db.query(db.sql, db.bindings...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		foreignKey := reflect.New(with.LocalKey.StructField.Type)
+		reference := reflect.New(with.ForeignKey.StructField.Type)
+
+		var data reflect.Value
+		if pivotSchema != nil {
+			data, err = db.rowHandle(pivotSchema, rows, foreignKey.Interface(), reference.Interface())
+		} else {
+			err = rows.Scan(foreignKey.Interface(), reference.Interface())
+		}
+
+		if err != nil {
+			return
+		}
+
+		pivots = append(pivots, pivot{
+			foreignKey: foreignKey.Elem().Interface(),
+			reference:  reference.Elem().Interface(),
+			data:       data,
+		})
+	}
+
+	err = rows.Err()
+	return
+}
+
+// setPivotRelationships 多对多关联：先查询中间表，再根据中间表的关联键批量查询关联模型
+func (d *DB) setPivotRelationships(with *With) {
+	pivots, err := d.getPivots(with, with.Values)
+	if err != nil {
+		d.AddError(err)
+		return
+	}
+
+	if len(pivots) == 0 {
+		return
+	}
+
+	references := make([]any, len(pivots))
+	for i, p := range pivots {
+		references[i] = p.reference
+	}
+
+	joinResults := schema.MakeSlice(with.ModelType).Elem()
+
+	db := d.ClonePure(1)
+
+	for modelName, funcList := range d.childWiths {
+		db.With(modelName, funcList...)
+	}
+
+	with.Callback(db)
+	err = db.Where(with.ForeignKey.FieldName, "in", references).Get(joinResults.Addr().Interface())
+
+	if err != nil {
+		if err != ErrNotFind {
+			d.AddError(err)
+		}
+		return
+	}
+
+	models := make(map[any]reflect.Value, joinResults.Len())
+	for i := 0; i < joinResults.Len(); i++ {
+		val := joinResults.Index(i)
+		models[val.FieldByName(with.ForeignKey.Name).Interface()] = val
+	}
+
+	for _, p := range pivots {
+		model, ok := models[p.reference]
+		if !ok {
+			continue
+		}
+
+		// 同一个关联模型可能属于多个父模型，中间表数据需要各自一份
+		if p.data.IsValid() {
+			val := reflect.New(with.ModelType).Elem()
+			val.Set(model)
+			val.FieldByName(with.Schema.PivotField).Set(p.data)
+			model = val
+		}
+
+		with.Relationships[p.foreignKey] = append(with.Relationships[p.foreignKey], model)
+	}
+}
+
+// pivotData 从关联模型的 pivot 字段中取出中间表的额外字段
+func (d *DB) pivotData(with *With, model reflect.Value) map[string]any {
+	pivotSchema := d.pivotSchema(with)
+	if pivotSchema == nil {
+		return nil
+	}
+
+	tableInfo := *pivotSchema
+	tableInfo.Value = model.FieldByName(with.Schema.PivotField)
+
+	data := tableInfo.RecordValues(false, false)
+	delete(data, with.JoinForeignKey)
+	delete(data, with.JoinReferences)
+	return data
+}
+
+// savePivots 创建还没有主键的关联模型并写入中间表，
+// sync 为 true 时同时删除不在 withModel 中的中间表记录
+func (d *DB) savePivots(db *DB, with *With, foreignKey any, withModel reflect.Value, sync bool) error {
+	if err := d.createPivotModels(db, with, withModel); err != nil {
+		return err
+	}
+
+	references, data := d.pivotReferences(with, withModel)
+
+	if !sync {
+		_, err := d.insertPivots(with, foreignKey, references, data)
+		return err
+	}
+	return d.syncPivots(with, foreignKey, references, data, true)
+}
+
+// createPivotModels 创建还没有主键的关联模型
+func (d *DB) createPivotModels(db *DB, with *With, withModel reflect.Value) error {
+	creates := make([]any, 0)
+	for i := 0; i < withModel.Len(); i++ {
+		model := withModel.Index(i)
+		if model.FieldByName(with.ForeignKey.Name).IsZero() {
+			creates = append(creates, model.Addr().Interface())
+		}
+	}
+
+	if len(creates) == 0 {
+		return nil
+	}
+
+	_, err := db.Create(creates...)
+	return err
+}
+
+// pivotReferences 返回关联模型的关联键及对应的中间表额外字段
+func (d *DB) pivotReferences(with *With, withModel reflect.Value) ([]any, []map[string]any) {
+	references := make([]any, 0, withModel.Len())
+	data := make([]map[string]any, 0, withModel.Len())
+	for i := 0; i < withModel.Len(); i++ {
+		model := withModel.Index(i)
+		references = append(references, model.FieldByName(with.ForeignKey.Name).Interface())
+		data = append(data, d.pivotData(with, model))
+	}
+	return references, data
+}
+
+// syncPivots 写入中间表中还不存在的记录，detach 为 true 时删除不在 references 中的记录
+func (d *DB) syncPivots(with *With, foreignKey any, references []any, data []map[string]any, detach bool) error {
+	pivots, err := d.getPivots(with, []any{foreignKey})
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[any]bool, len(pivots))
+	for _, p := range pivots {
+		exists[p.reference] = true
+	}
+
+	attaches := make([]any, 0, len(references))
+	attachData := make([]map[string]any, 0, len(references))
+	for i, reference := range references {
+		if exists[reference] {
+			delete(exists, reference)
+			continue
+		}
+
+		attaches = append(attaches, reference)
+		if i < len(data) {
+			attachData = append(attachData, data[i])
+		}
+	}
+
+	if detach && len(exists) > 0 {
+		detaches := make([]any, 0, len(exists))
+		for reference := range exists {
+			detaches = append(detaches, reference)
+		}
+
+		if _, err = d.deletePivots(with, foreignKey, detaches); err != nil {
+			return err
+		}
+	}
+
+	_, err = d.insertPivots(with, foreignKey, attaches, attachData)
+	return err
+}
+
+// insertPivots 写入中间表，data 与 references 一一对应，可以为空
+func (d *DB) insertPivots(with *With, foreignKey any, references []any, data []map[string]any) (int64, error) {
+	if len(references) == 0 {
+		return 0, nil
+	}
+
+	values := make([]any, len(references))
+	for i, reference := range references {
+		value := map[string]any{
+			with.JoinForeignKey: foreignKey,
+			with.JoinReferences: reference,
+		}
+
+		if i < len(data) {
+			for k, v := range data[i] {
+				value[k] = v
+			}
+		}
+		values[i] = value
+	}
+
+	return d.ClonePure(1).Table(with.JoinTable).Create(values...)
+}
+
+// deletePivots 删除中间表记录，references 为空时删除 foreignKey 的所有记录
+func (d *DB) deletePivots(with *With, foreignKey any, references []any) (int64, error) {
+	db := d.ClonePure(1)
+	db.b.Table(with.JoinTable).Where(with.JoinForeignKey, foreignKey)
+
+	if len(references) > 0 {
+		db.b.Where(with.JoinReferences, "in", references)
+	}
+
+	sql, params := db.b.Delete()
+	result, err := db.exec(sql, params...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,57 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/drive/postgres"
+	"testing"
+)
+
+func TestPostgres_Create(t *testing.T) {
+	db, err := Open(postgres.Open("host=127.0.0.1 port=5432 user=postgres dbname=orm_demo sslmode=disable"))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	type Goods struct {
+		Model
+		Name  string  `orm:"unique"`
+		Price float64 `orm:"decimal:10,2"`
+		Stock int     `orm:"index"`
+	}
+
+	if err = db.Migrate.Auto(Goods{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	goods := []Goods{{Name: "apple", Price: 1.5}, {Name: "pear", Price: 2}}
+	if _, err = db.Create(&goods); err != nil {
+		t.Fatal(err)
+	}
+
+	if goods[0].Id == 0 || goods[1].Id == 0 {
+		t.Errorf("returning id %v %v", goods[0].Id, goods[1].Id)
+	}
+
+	var list []Goods
+	if err = db.Where("name", "in", []string{"apple", "pear"}).Page(1, 10).Get(&list); err != nil {
+		t.Error(err)
+	}
+	t.Log(list)
+}
+
+func TestPostgres_Rebind(t *testing.T) {
+	dialect := postgres.Open("")
+
+	tests := map[string]string{
+		"SELECT * FROM `user` WHERE `name` = ? AND `id` > ?":       `SELECT * FROM "user" WHERE "name" = $1 AND "id" > $2`,
+		"SELECT * FROM `user` WHERE `name` = 'a?' AND `id` = ?":    `SELECT * FROM "user" WHERE "name" = 'a?' AND "id" = $1`,
+		"SELECT * FROM `user` WHERE `name` = 'it''s?' AND `id`=?":  `SELECT * FROM "user" WHERE "name" = 'it''s?' AND "id"=$1`,
+		"SELECT * FROM `user` WHERE `name` = 'it\\'s?' AND `id`=?": `SELECT * FROM "user" WHERE "name" = 'it\'s?' AND "id"=$1`,
+		"SELECT * FROM `user` LIMIT 10,20":                         `SELECT * FROM "user" LIMIT 20 OFFSET 10`,
+	}
+
+	for sql, want := range tests {
+		if got := dialect.Rebind(sql); got != want {
+			t.Errorf("Rebind(%s) = %s, want %s", sql, got, want)
+		}
+	}
+}
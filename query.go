@@ -93,6 +93,7 @@ func (d *DB) Get(value any) error {
 
 	tableInfo := db.getTableInfo(value)
 
+	var aggregates []*schema.Field
 	if db.sql == "" {
 		if model, ok := tableInfo.Model.(IBeforeQuery); ok {
 			err := model.BeforeQuery(db)
@@ -109,14 +110,35 @@ func (d *DB) Get(value any) error {
 			db = db.setTableName(tableInfo)
 		}
 
-		if db.withDel == false && tableInfo.GetField("DeletedAt") != nil {
-			db.WhereNull(db.b.TableAlias + ".deleted_at")
+		if err := db.applyConditions(tableInfo); err != nil {
+			return err
 		}
 
+		fields, bindings, err := db.applyAggregates(tableInfo)
+		if err != nil {
+			return err
+		}
+		aggregates = fields
+
+		db.applyScopes(tableInfo, db.b.TableAlias)
+
 		db.sql, db.bindings = db.b.ToSql()
+		db.sql += db.lockClause()
+		// 关联聚合的子查询在查询字段中，参数排在最前面
+		db.bindings = append(bindings, db.bindings...)
 	}
 
-	rows, err := db.Query(db.sql, db.bindings...)
+	stmt := &Statement{DB: db, Schema: tableInfo, Dest: value}
+	return db.callback.Query().execute(stmt, func() (string, []any, error) {
+		return db.sql, db.bindings, nil
+	}, func(stmt *Statement) error {
+		return db.scanRows(stmt, tableInfo, aggregates)
+	})
+}
+
+// scanRows 执行查询并扫描到模型中，加载关联模型
+func (d *DB) scanRows(stmt *Statement, tableInfo *schema.Schema, aggregates []*schema.Field) error {
+	rows, err := d.query(stmt.SQL, stmt.Vars...)
 	if err != nil {
 		return err
 	}
@@ -124,32 +146,41 @@ func (d *DB) Get(value any) error {
 	defer rows.Close()
 
 	if tableInfo.Type.Kind() == reflect.Map {
-		return db.rowsBuildMap(rows, tableInfo)
+		return d.rowsBuildMap(rows, tableInfo)
 	}
 
-	withs := db.makeWiths(tableInfo)
+	withs := d.makeWiths(tableInfo)
 
 	var dests []reflect.Value
 	for rows.Next() {
-		dest, err1 := db.rowHandle(tableInfo, rows)
+		scans := aggregateScans(aggregates)
+		dest, err1 := d.rowHandle(tableInfo, rows, scans...)
 		if err1 == nil {
+			for i, field := range aggregates {
+				dest.FieldByName(field.Name).Set(reflect.ValueOf(scans[i]).Elem())
+			}
 			dests = append(dests, dest)
-			db.getWiths(withs, dest)
+			d.getWiths(withs, dest)
 		} else {
-			db.AddError(err)
+			d.AddError(err1)
 		}
 	}
 
-	if len(dests) == 0 {
+	// 扫描失败、AfterQuery 或 Retrieved 返回错误时不能当作没有记录
+	if d.Error != nil {
+		return d.Error
+	}
+
+	if stmt.RowsAffected = int64(len(dests)); stmt.RowsAffected == 0 {
 		return ErrNotFind
 	}
 
-	db.relationships(withs)
+	d.relationships(withs)
 
-	db.setDestRelationships(dests, withs, tableInfo.Value)
+	d.setDestRelationships(dests, withs, tableInfo.Value)
 
-	if db.Error != nil {
-		return db.Error
+	if d.Error != nil {
+		return d.Error
 	}
 
 	return nil
@@ -176,9 +207,10 @@ func (d *DB) First(value any) error {
 	return nil
 }
 
-func (d *DB) rowHandle(tableInfo *schema.Schema, rows *sql.Rows) (dest reflect.Value, err error) {
+// rowHandle 将一行数据扫描到模型中，extras 用于接收模型字段之后的额外列
+func (d *DB) rowHandle(tableInfo *schema.Schema, rows *sql.Rows, extras ...any) (dest reflect.Value, err error) {
 	dest = reflect.New(tableInfo.Type).Elem()
-	var values = make([]any, len(tableInfo.Fields))
+	var values = make([]any, len(tableInfo.Fields), len(tableInfo.Fields)+len(extras))
 	var jsons = make(map[string]*[]byte)
 
 	for i, field := range tableInfo.Fields {
@@ -192,6 +224,8 @@ func (d *DB) rowHandle(tableInfo *schema.Schema, rows *sql.Rows) (dest reflect.V
 		}
 
 	}
+	values = append(values, extras...)
+
 	if err = rows.Scan(values...); err != nil {
 		return
 	}
@@ -212,6 +246,8 @@ func (d *DB) rowHandle(tableInfo *schema.Schema, rows *sql.Rows) (dest reflect.V
 			return
 		}
 	}
+
+	err = d.observeRetrieved(dest)
 	return
 }
 
@@ -219,16 +255,34 @@ func (d *DB) Value(field string, value any) (err error) {
 	defer d.resetClone()
 	db := d.getInstance()
 
-	db.sql, db.bindings = db.b.Select(field).Limit(1).ToSql()
-
-	rows, err := db.Query(db.sql, db.bindings...)
-	if err != nil {
+	if err = db.applyConditions(db.schema); err != nil {
 		return
 	}
 
-	defer rows.Close()
-	rows.Next()
-	rows.Scan(value)
+	db.applyScopes(db.schema, "")
 
-	return
+	db.sql, db.bindings = db.b.Select(field).Limit(1).ToSql()
+	db.sql += db.lockClause()
+
+	return db.queryValue(value)
+}
+
+// queryValue 执行只返回一个值的查询，没有记录时 value 不变
+func (d *DB) queryValue(value any) error {
+	stmt := &Statement{DB: d, Schema: d.schema, Dest: value}
+	return d.callback.Query().execute(stmt, func() (string, []any, error) {
+		return d.sql, d.bindings, nil
+	}, func(stmt *Statement) error {
+		rows, err := d.query(stmt.SQL, stmt.Vars...)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+		if rows.Next() {
+			stmt.RowsAffected = 1
+		}
+		rows.Scan(value)
+		return nil
+	})
 }
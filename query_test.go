@@ -1,8 +1,15 @@
 package orm
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/kwinh/go-orm/schema"
 	sqlBuilder "github.com/kwinh/go-sql-builder"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDB_Find(t *testing.T) {
@@ -130,3 +137,875 @@ func TestDB_SubQuery(t *testing.T) {
 	}
 	t.Logf("%#v", users)
 }
+
+func TestDB_WithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var u []User
+	err := orm.WithContext(ctx).Where("id", ">", 0).Get(&u)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Error(err)
+	}
+}
+
+func TestQuery_Generics(t *testing.T) {
+	created := User{UserName: "generics", Nickname: "generics"}
+	if _, err := Q[User](orm).Create(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Id == 0 {
+		t.Fatal("create did not set id")
+	}
+
+	u, err := Q[User](orm).Where("id", created.Id).First()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Id != created.Id || u.UserName != "generics" {
+		t.Errorf("first %+v", u)
+	}
+
+	users, err := Q[User](orm).Where("id", ">=", created.Id).Limit(10).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) == 0 || users[0].Id != created.Id {
+		t.Errorf("all %+v", users)
+	}
+
+	count, err := Q[User](orm).Where("id", created.Id).Count()
+	if err != nil || count != 1 {
+		t.Errorf("count %d %v", count, err)
+	}
+
+	if _, err = Q[User](orm).Delete(&created, true); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Q[*User](orm).First(); !errors.Is(err, ErrParam) {
+		t.Errorf("pointer type %v", err)
+	}
+}
+
+func TestDB_OnlyTrashed(t *testing.T) {
+	type Ticket struct {
+		Model
+		Title string
+	}
+
+	if err := orm.Migrate.Auto(Ticket{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := &Ticket{Title: "first"}, &Ticket{Title: "second"}
+	if _, err := orm.Create(first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := orm.Delete(second); err != nil {
+		t.Fatal(err)
+	}
+
+	//SELECT COUNT(*) FROM `ticket` WHERE `deleted_at` IS NULL
+	live, err := orm.Model(&Ticket{}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//SELECT COUNT(*) FROM `ticket` WHERE `deleted_at` IS NOT NULL
+	trashed, err := orm.Model(&Ticket{}).OnlyTrashed().Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if live != 1 || trashed != 1 {
+		t.Errorf("live %d, trashed %d", live, trashed)
+	}
+
+	var tickets []Ticket
+	if err = orm.OnlyTrashed().Get(&tickets); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tickets[0].IsTrashed() {
+		t.Error("expected trashed ticket")
+	}
+
+	if _, err = orm.Restore(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if live, _ = orm.Model(&Ticket{}).Count(); live != 2 {
+		t.Errorf("live %d after restore", live)
+	}
+
+	if _, err = orm.ForceDelete(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if total, _ := orm.Model(&Ticket{}).WithDelete().Count(); total != 1 {
+		t.Errorf("total %d after force delete", total)
+	}
+}
+
+func TestDB_SoftDeleteType(t *testing.T) {
+	type Voucher struct {
+		Id        uint `orm:"autoIncrement"`
+		Code      string
+		IsDeleted bool `orm:"softDelete:flag"`
+	}
+
+	type Coupon struct {
+		Id        uint `orm:"autoIncrement"`
+		Code      string
+		DeletedAt int64 `orm:"softDelete:unix"`
+	}
+
+	for _, model := range []any{Voucher{}, Coupon{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	voucher := &Voucher{Code: "v1"}
+	if _, err := orm.Create(voucher); err != nil {
+		t.Fatal(err)
+	}
+
+	//UPDATE `voucher` SET `is_deleted`=1 WHERE `id` = ? AND `is_deleted` = 0
+	if _, err := orm.Delete(voucher); err != nil {
+		t.Fatal(err)
+	}
+
+	var vouchers []Voucher
+	if err := orm.OnlyTrashed().Where("id", voucher.Id).Get(&vouchers); err != nil {
+		t.Fatal(err)
+	}
+
+	if !vouchers[0].IsDeleted || !orm.IsTrashed(&vouchers[0]) {
+		t.Error("expected deleted flag")
+	}
+
+	coupon := &Coupon{Code: "c1"}
+	if _, err := orm.Create(coupon); err != nil {
+		t.Fatal(err)
+	}
+
+	//UPDATE `coupon` SET `deleted_at`=? WHERE `id` = ? AND `deleted_at` = 0
+	if _, err := orm.Delete(coupon); err != nil {
+		t.Fatal(err)
+	}
+
+	var coupons []Coupon
+	if err := orm.WithDelete().Where("id", coupon.Id).Get(&coupons); err != nil {
+		t.Fatal(err)
+	}
+
+	if coupons[0].DeletedAt == 0 || !orm.IsTrashed(&coupons[0]) {
+		t.Error("expected deleted timestamp")
+	}
+
+	if _, err := orm.Restore(coupon); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ := orm.Model(&Coupon{}).Where("id", coupon.Id).Count(); count != 1 {
+		t.Errorf("count %d after restore", count)
+	}
+
+	// 不支持的软删除方式解析时 panic
+	type Ticket struct {
+		Id      uint `orm:"autoIncrement"`
+		Removed int  `orm:"softDelete:weekly"`
+	}
+
+	defer func() {
+		if p := recover(); p == nil {
+			t.Error("invalid soft delete type parsed")
+		}
+	}()
+	schema.Parse(&Ticket{}, orm.dialector, orm.TablePrefix)
+}
+
+type ScopedOrder struct {
+	Model
+	ShopId int
+	Status string
+}
+
+var _ IGlobalScopes = (*ScopedOrder)(nil)
+
+func (ScopedOrder) GlobalScopes() map[string]ScopeFunc {
+	return map[string]ScopeFunc{
+		"shop": func(db *DB) *DB {
+			return db.Where("shop_id", 1)
+		},
+	}
+}
+
+func TestDB_Scopes(t *testing.T) {
+	if err := orm.Migrate.Auto(ScopedOrder{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := orm.Create(&ScopedOrder{ShopId: 1, Status: "paid"},
+		&ScopedOrder{ShopId: 1, Status: "unpaid"}, &ScopedOrder{ShopId: 2, Status: "paid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paid := func(db *DB) *DB {
+		return db.Where("status", "paid")
+	}
+
+	var orders []ScopedOrder
+	//SELECT * FROM `scoped_order` WHERE `status` = ? AND `deleted_at` IS NULL AND `shop_id` = ?
+	if err = orm.Scopes(paid).Get(&orders); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, order := range orders {
+		if order.ShopId != 1 || order.Status != "paid" {
+			t.Errorf("order %+v", order)
+		}
+	}
+
+	scoped, err := orm.Model(&ScopedOrder{}).Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := orm.Model(&ScopedOrder{}).WithoutGlobalScope("shop").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scoped >= all {
+		t.Errorf("scoped %d, all %d", scoped, all)
+	}
+}
+
+func TestDB_WithTenant(t *testing.T) {
+	type TenantOrder struct {
+		Model
+		TenantId int
+		Status   string
+	}
+
+	config := *orm.Config
+	config.TenantColumn = "tenant_id"
+	db := &DB{Config: &config}
+
+	if err := db.Migrate.Auto(TenantOrder{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	order := TenantOrder{Status: "paid"}
+	if _, err := db.WithTenant(1).Create(&order); err != nil {
+		t.Fatal(err)
+	}
+
+	if order.TenantId != 1 {
+		t.Errorf("tenant %d", order.TenantId)
+	}
+
+	ctx := ContextWithTenant(context.Background(), 2)
+	if _, err := db.WithContext(ctx).Create(&TenantOrder{Status: "paid"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var orders []TenantOrder
+	//SELECT * FROM `tenant_order` WHERE `deleted_at` IS NULL AND `tenant_id` = ?
+	if err := db.WithContext(ctx).Get(&orders); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, o := range orders {
+		if o.TenantId != 2 {
+			t.Errorf("order %+v", o)
+		}
+	}
+
+	_, err := db.WithTenant(2).Update(&TenantOrder{Model: Model{Id: order.Id}, TenantId: 1, Status: "unpaid"})
+	var tenantErr *TenantError
+	if !errors.As(err, &tenantErr) || !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("update %v", err)
+	}
+
+	_, err = db.WithTenant(2).Model(&TenantOrder{}).Where("id", order.Id).Update(map[string]any{"tenant_id": 1})
+	if !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("update map %v", err)
+	}
+
+	affected, err := db.WithTenant(2).Where("id", order.Id).Delete(&TenantOrder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if affected != 0 {
+		t.Errorf("deleted %d orders of other tenant", affected)
+	}
+
+	// 冲突的记录可能属于其他租户
+	upsert := &TenantOrder{Model: Model{Id: order.Id}, Status: "unpaid"}
+	if _, err = db.WithTenant(2).Upsert(upsert, OnConflict{}); !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("upsert %v", err)
+	}
+}
+
+func TestDB_Version(t *testing.T) {
+	type Article struct {
+		Model
+		Title   string
+		Version uint `orm:"version"`
+	}
+
+	if err := orm.Migrate.Auto(Article{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	article := Article{Title: "test"}
+	if _, err := orm.Create(&article); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := article
+
+	article.Title = "first"
+	//UPDATE `article` SET ...,`version`=? WHERE `id` = ? AND `version` = ? AND `deleted_at` IS NULL
+	if _, err := orm.Update(&article); err != nil {
+		t.Fatal(err)
+	}
+
+	if article.Version != 1 {
+		t.Errorf("version %d", article.Version)
+	}
+
+	stale.Title = "second"
+	if _, err := orm.Update(&stale); !errors.Is(err, ErrStaleObject) {
+		t.Errorf("update stale %v", err)
+	}
+
+	if stale.Version != 0 {
+		t.Errorf("stale version %d", stale.Version)
+	}
+
+	// 已软删除的记录不是版本号冲突
+	if _, err := orm.Delete(&article); err != nil {
+		t.Fatal(err)
+	}
+
+	article.Title = "third"
+	if _, err := orm.Update(&article); !errors.Is(err, ErrNotFind) {
+		t.Errorf("update trashed %v", err)
+	}
+}
+
+func TestDB_LockForUpdate(t *testing.T) {
+	err := orm.Transaction(func(db *DB) error {
+		var user User
+		//SELECT * FROM `user` WHERE `id` = ? LIMIT 1 FOR UPDATE
+		if err := db.LockForUpdate().Find(&user, 1); err != nil {
+			return err
+		}
+
+		var users []User
+		//SELECT * FROM `user` WHERE `id` > ? LOCK IN SHARE MODE
+		return db.SharedLock().Where("id", ">", 1).Get(&users)
+	})
+
+	if err != nil && !errors.Is(err, ErrNotFind) {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_Upsert(t *testing.T) {
+	type Account struct {
+		Model
+		Email string `orm:"unique"`
+		Name  string
+	}
+
+	if err := orm.Migrate.Auto(Account{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := []Account{{Email: "a@test.com", Name: "a"}, {Email: "b@test.com", Name: "b"}}
+	if _, err := orm.Upsert(&accounts, OnConflict{Columns: []string{"email"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//INSERT INTO `account` (...) VALUES (...) ON DUPLICATE KEY UPDATE `id`=LAST_INSERT_ID(`id`),`name`=VALUES(`name`)
+	updated := &Account{Email: "a@test.com", Name: "c"}
+	_, err := orm.Upsert(updated, OnConflict{Columns: []string{"email"}, Update: []string{"name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//INSERT INTO `account` (...) VALUES (...) ON DUPLICATE KEY UPDATE `id`=LAST_INSERT_ID(`id`)
+	ignored := &Account{Email: "b@test.com", Name: "d"}
+	if _, err = orm.Upsert(ignored, OnConflict{Columns: []string{"email"}, DoNothing: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var result []Account
+	if err = orm.Where("email", "in", []string{"a@test.com", "b@test.com"}).Get(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, account := range result {
+		if account.Email == "a@test.com" && account.Name != "c" || account.Email == "b@test.com" && account.Name != "b" {
+			t.Errorf("account %+v", account)
+		}
+
+		// 写入一条记录时回写冲突的记录的主键
+		if account.Email == "a@test.com" && updated.Id != account.Id || account.Email == "b@test.com" && ignored.Id != account.Id {
+			t.Errorf("upsert ids %d %d, account %+v", updated.Id, ignored.Id, account)
+		}
+	}
+}
+
+func TestDB_SavePoint(t *testing.T) {
+	type Ledger struct {
+		Model
+		Name string
+	}
+
+	if err := orm.Migrate.Auto(Ledger{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	inner := errors.New("inner")
+	err := orm.Transaction(func(db *DB) error {
+		if _, err := db.Create(&Ledger{Name: "outer"}); err != nil {
+			return err
+		}
+
+		//SAVEPOINT `sp_1` ... ROLLBACK TO SAVEPOINT `sp_1`
+		err := db.Transaction(func(db *DB) error {
+			if _, err := db.Create(&Ledger{Name: "inner"}); err != nil {
+				return err
+			}
+			return inner
+		})
+
+		if !errors.Is(err, inner) {
+			t.Errorf("inner %v", err)
+		}
+
+		if err = db.SavePoint("manual"); err != nil {
+			return err
+		}
+
+		if _, err = db.Create(&Ledger{Name: "manual"}); err != nil {
+			return err
+		}
+		return db.RollbackTo("manual")
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ledgers []Ledger
+	if err = orm.Get(&ledgers); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ledger := range ledgers {
+		if ledger.Name != "outer" {
+			t.Errorf("ledger %+v", ledger)
+		}
+	}
+
+	if err = orm.SavePoint("manual"); !errors.Is(err, ErrMissingTx) {
+		t.Errorf("savepoint outside transaction %v", err)
+	}
+}
+
+func TestDB_TransactionWith(t *testing.T) {
+	attempts := 0
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+	err := orm.TransactionWith(TxOptions{Isolation: sql.LevelSerializable, MaxRetries: 2, Backoff: time.Millisecond}, func(db *DB) error {
+		attempts++
+		if attempts < 3 {
+			return deadlock
+		}
+
+		var users []User
+		if err := db.Limit(1).Get(&users); err != nil && !errors.Is(err, ErrNotFind) {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("attempts %d", attempts)
+	}
+
+	attempts = 0
+	err = orm.TransactionWith(TxOptions{ReadOnly: true, MaxRetries: 2}, func(db *DB) error {
+		attempts++
+		return ErrParam
+	})
+
+	if !errors.Is(err, ErrParam) || attempts != 1 {
+		t.Errorf("attempts %d, err %v", attempts, err)
+	}
+}
+
+type CommitOrder struct {
+	Model
+	No     string
+	events *[]string
+}
+
+var _ IAfterCommitCreate = (*CommitOrder)(nil)
+
+func (o *CommitOrder) AfterCommitCreate(*DB) {
+	*o.events = append(*o.events, "created "+o.No)
+}
+
+func TestDB_AfterCommit(t *testing.T) {
+	for _, model := range []any{CommitOrder{}, CommitCode{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var events []string
+	err := orm.Transaction(func(db *DB) error {
+		if _, err := db.Create(&CommitOrder{No: "1", events: &events}); err != nil {
+			return err
+		}
+
+		db.AfterCommit(func() {
+			events = append(events, "commit")
+		})
+
+		if len(events) > 0 {
+			t.Errorf("events %v before commit", events)
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || events[0] != "created 1" || events[1] != "commit" {
+		t.Errorf("events %v", events)
+	}
+
+	events = nil
+	rollback := errors.New("rollback")
+	err = orm.Transaction(func(db *DB) error {
+		if _, err := db.Create(&CommitOrder{No: "2", events: &events}); err != nil {
+			return err
+		}
+
+		db.AfterRollback(func() {
+			events = append(events, "rollback")
+		})
+		return rollback
+	})
+
+	if !errors.Is(err, rollback) {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0] != "rollback" {
+		t.Errorf("events %v", events)
+	}
+
+	// 嵌套事务回滚后释放保存点，非自增主键的模型也会执行 AfterCommitCreate
+	events = nil
+	err = orm.Transaction(func(db *DB) error {
+		nested, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		nested.AfterRollback(func() {
+			events = append(events, "nested rollback")
+		})
+
+		if err = nested.Rollback(); err != nil {
+			return err
+		}
+
+		if err = db.RollbackTo(nested.savepoint); err == nil {
+			t.Error("savepoint not released")
+		}
+
+		_, err = db.Create(&CommitCode{Code: "c1", events: &events})
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || events[0] != "nested rollback" || events[1] != "created c1" {
+		t.Errorf("events %v", events)
+	}
+}
+
+type CommitCode struct {
+	Code   string `orm:"primaryKey"`
+	events *[]string
+}
+
+var _ IAfterCommitCreate = (*CommitCode)(nil)
+
+func (c *CommitCode) AfterCommitCreate(*DB) {
+	*c.events = append(*c.events, "created "+c.Code)
+}
+
+func TestDB_Callback(t *testing.T) {
+	type CallbackPost struct {
+		Model
+		Title     string
+		CreatedBy string
+	}
+
+	config := *orm.Config
+	config.callback = newCallbacks()
+	db := &DB{Config: &config}
+
+	if err := db.Migrate.Auto(CallbackPost{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	db.Callback().Create().Before("audit", func(stmt *Statement) error {
+		order = append(order, "audit")
+		return nil
+	}).After("created_by")
+	db.Callback().Create().Before("created_by", func(stmt *Statement) error {
+		order = append(order, "created_by")
+		for _, values := range stmt.Values {
+			values["created_by"] = "kwin"
+		}
+		return nil
+	})
+
+	post := CallbackPost{Title: "hello"}
+	if _, err := db.Create(&post); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 2 || order[0] != "created_by" || order[1] != "audit" {
+		t.Errorf("order %v", order)
+	}
+
+	var createdBy string
+	if err := db.Model(&CallbackPost{}).Where("id", post.Id).Value("created_by", &createdBy); err != nil {
+		t.Fatal(err)
+	}
+
+	if createdBy != "kwin" {
+		t.Errorf("created_by %q", createdBy)
+	}
+
+	denied := errors.New("denied")
+	db.Callback().Update().Before("deny", func(stmt *Statement) error {
+		return denied
+	})
+
+	post.Title = "world"
+	if _, err := db.Update(&post); !errors.Is(err, denied) {
+		t.Errorf("update %v", err)
+	}
+
+	db.Callback().Update().Remove("deny")
+	if _, err := db.Update(&post); err != nil {
+		t.Error(err)
+	}
+
+	order = nil
+	db.Callback().Update().After("notify", func(stmt *Statement) error {
+		order = append(order, "notify")
+		return nil
+	})
+	db.Callback().Update().After("audit", func(stmt *Statement) error {
+		order = append(order, "audit")
+		return nil
+	}).Before("notify")
+	db.Callback().Update().Before("audit", func(stmt *Statement) error {
+		order = append(order, "before audit")
+		return nil
+	})
+
+	post.Title = "again"
+	if _, err := db.Update(&post); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 3 || order[0] != "before audit" || order[1] != "audit" || order[2] != "notify" {
+		t.Errorf("order %v", order)
+	}
+
+	var sql string
+	db.Callback().Delete().After("sql", func(stmt *Statement) error {
+		sql = stmt.SQL
+		return nil
+	})
+
+	if _, err := db.Delete(&post); err != nil {
+		t.Fatal(err)
+	}
+
+	if sql == "" {
+		t.Error("delete callback not executed")
+	}
+}
+
+type observeEvents []string
+
+func (e *observeEvents) Saving(db *DB, model any) error {
+	*e = append(*e, "saving")
+	return nil
+}
+
+func (e *observeEvents) Creating(db *DB, model any) error {
+	if model.(*User).UserName == "" {
+		return ErrParam
+	}
+	*e = append(*e, "creating")
+	return nil
+}
+
+func (e *observeEvents) Created(db *DB, model any) error {
+	*e = append(*e, "created")
+	return nil
+}
+
+func (e *observeEvents) Updated(db *DB, model any) error {
+	*e = append(*e, "updated")
+	return nil
+}
+
+func (e *observeEvents) Deleted(db *DB, model any) error {
+	*e = append(*e, "deleted")
+	return nil
+}
+
+func TestDB_Observe(t *testing.T) {
+	config := *orm.Config
+	config.observers = newObservers()
+	db := &DB{Config: &config}
+
+	events := &observeEvents{}
+	db.Observe(&User{}, events)
+
+	users := []User{{UserName: "observe1"}, {UserName: "observe2"}}
+	if _, err := db.Create(&users); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*events) != 6 {
+		t.Errorf("events %v", *events)
+	}
+
+	if _, err := db.Create(&User{}); !errors.Is(err, ErrParam) {
+		t.Errorf("create %v", err)
+	}
+
+	*events = nil
+	users[0].UserName = "observe"
+	if _, err := db.Update(&users[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Delete(&users[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*events) != 3 || (*events)[1] != "updated" || (*events)[2] != "deleted" {
+		t.Errorf("events %v", *events)
+	}
+
+	denied := errors.New("denied")
+	db.Observe(&User{}, retrievedObserver{err: denied})
+
+	var user User
+	if err := db.Where("id", users[1].Id).First(&user); !errors.Is(err, denied) {
+		t.Errorf("first %v", err)
+	}
+
+	var list []User
+	if err := db.Get(&list); !errors.Is(err, denied) {
+		t.Errorf("get %v", err)
+	}
+}
+
+type retrievedObserver struct {
+	err error
+}
+
+func (o retrievedObserver) Retrieved(db *DB, model any) error {
+	return o.err
+}
+
+type HookCode struct {
+	Code   string `orm:"primaryKey"`
+	events *[]string
+}
+
+func (c *HookCode) BeforeCreate(*DB) error {
+	*c.events = append(*c.events, "before "+c.Code)
+	return nil
+}
+
+func (c *HookCode) AfterCreate(*DB) error {
+	*c.events = append(*c.events, "after "+c.Code)
+	return nil
+}
+
+type hookCodeObserver struct{}
+
+func (hookCodeObserver) Creating(db *DB, model any) error {
+	code := model.(*HookCode)
+	*code.events = append(*code.events, "creating "+code.Code)
+	return nil
+}
+
+func (hookCodeObserver) Created(db *DB, model any) error {
+	code := model.(*HookCode)
+	*code.events = append(*code.events, "created "+code.Code)
+	return nil
+}
+
+func TestDB_CreateHooks(t *testing.T) {
+	config := *orm.Config
+	config.observers = newObservers()
+	db := &DB{Config: &config}
+
+	if err := db.Migrate.Auto(HookCode{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	db.Observe(&HookCode{}, hookCodeObserver{})
+
+	// 批量插入时每条记录都执行钩子和观察者，非自增主键也执行创建后的钩子
+	var events []string
+	codes := []HookCode{{Code: "a", events: &events}, {Code: "b", events: &events}}
+	if _, err := db.Create(&codes); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"before a", "creating a", "before b", "creating b", "after a", "created a", "after b", "created b"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events %v", events)
+	}
+}
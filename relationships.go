@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"fmt"
 	"github.com/kwinh/go-orm/schema"
 	"reflect"
 	"strings"
@@ -55,8 +56,22 @@ func (d *DB) makeWiths(tableInfo *schema.Schema) []*With {
 	withs := make([]*With, 0)
 	for key, callback := range d.withs {
 		if w, ok := tableInfo.Withs[key]; ok {
+			// 远程关联的中间模型可能在解析模型之后才注册
+			if w = w.ResolveThrough(); w == nil {
+				d.AddError(fmt.Errorf("%w: %s.%s", ErrMissingRelation, tableInfo.Name, key))
+				continue
+			}
+
+			// schema 是缓存共享的，每次查询使用独立的 Values、Relationships
+			w1 := *w
+			w1.Values = nil
+			w1.Relationships = make(map[any][]reflect.Value)
+			if w1.Type == schema.MorphOne || w1.Type == schema.MorphMany {
+				w1.MorphValue = schema.MorphName(tableInfo)
+			}
+
 			with := &With{
-				With:     w,
+				With:     &w1,
 				Callback: callback,
 			}
 
@@ -79,6 +94,14 @@ func (d *DB) getWiths(withs []*With, dest reflect.Value) {
 
 		localKeyValue = val.Interface()
 
+		// morphTo 关联的模型由类型字段决定，按类型分组查询
+		if with.Type == schema.MorphTo {
+			localKeyValue = morphKey{
+				name: fmt.Sprint(dest.FieldByName(with.MorphType.Name).Interface()),
+				key:  localKeyValue,
+			}
+		}
+
 		with.Values = append(with.Values, localKeyValue)
 	}
 }
@@ -100,6 +123,18 @@ func (d *DB) setWithRelationships(with *With, wg *sync.WaitGroup) {
 		return
 	}
 
+	switch with.Type {
+	case schema.ManyToMany:
+		d.setPivotRelationships(with)
+		return
+	case schema.MorphTo:
+		d.setMorphToRelationships(with)
+		return
+	case schema.HasOneThrough, schema.HasManyThrough:
+		d.setThroughRelationships(with)
+		return
+	}
+
 	joinResults := schema.MakeSlice(with.ModelType).Elem()
 
 	db := d.ClonePure(1)
@@ -109,20 +144,37 @@ func (d *DB) setWithRelationships(with *With, wg *sync.WaitGroup) {
 	}
 
 	with.Callback(db)
+
+	if with.MorphType != nil {
+		db.Where(with.MorphType.FieldName, with.MorphValue)
+	}
+
 	err := db.Where(with.ForeignKey.FieldName, "in", with.Values).Get(joinResults.Addr().Interface())
 
 	if err != nil {
-		d.AddError(err)
+		// 没有关联数据不算错误
+		if err != ErrNotFind {
+			d.AddError(err)
+		}
 		return
 	}
 
+	keyType := with.LocalKey.StructField.Type
 	for i := 0; i < joinResults.Len(); i++ {
 		val := joinResults.Index(i)
-		key := val.FieldByName(with.ForeignKey.Name).Interface()
+		key := relationKey(val.FieldByName(with.ForeignKey.Name), keyType)
 		with.Relationships[key] = append(with.Relationships[key], val)
 	}
 }
 
+// relationKey 关联模型的键转换为当前模型关联键的类型，例如 User.Id uint 与 Post.UserId int64 也能对应
+func relationKey(key reflect.Value, keyType reflect.Type) any {
+	if key.Type() != keyType && key.CanConvert(keyType) {
+		key = key.Convert(keyType)
+	}
+	return key.Interface()
+}
+
 func (d *DB) setDestRelationships(dests []reflect.Value, withs []*With, value reflect.Value) {
 	for _, dest := range dests {
 		wg := &sync.WaitGroup{}
@@ -142,14 +194,125 @@ func (d *DB) setDestRelationships(dests []reflect.Value, withs []*With, value re
 
 func (d *DB) setDestRelationship(with *With, dest reflect.Value, wg *sync.WaitGroup) {
 	defer wg.Done()
-	relationshipValues := with.Relationships[dest.FieldByName(with.LocalKey.Name).Interface()]
+
+	var key any = dest.FieldByName(with.LocalKey.Name).Interface()
+	if with.Type == schema.MorphTo {
+		key = morphKey{
+			name: fmt.Sprint(dest.FieldByName(with.MorphType.Name).Interface()),
+			key:  key,
+		}
+	}
+
+	relationshipValues := with.Relationships[key]
 	if relationshipValues != nil {
 		switch with.Type {
-		case schema.One:
+		case schema.One, schema.BelongsTo, schema.MorphOne, schema.HasOneThrough:
 			dest.FieldByName(with.Name).Set(relationshipValues[0])
-		case schema.Many:
+		case schema.MorphTo:
+			setMorphTo(dest.FieldByName(with.Name), relationshipValues[0])
+		case schema.Many, schema.ManyToMany, schema.MorphMany, schema.HasManyThrough:
 			joinResults := schema.MakeSlice(with.ModelType).Elem()
 			dest.FieldByName(with.Name).Set(reflect.Append(joinResults, relationshipValues...))
 		}
 	}
 }
+
+// Load 为已经查询出来的模型加载关联，value 为模型或模型切片的指针，name 支持 "Orders.Items" 嵌套关联
+//
+//	err := db.Load(&users, "Contact", "Orders.Items")
+func (d *DB) Load(value any, names ...string) error {
+	return d.load(value, false, names...)
+}
+
+// LoadMissing 只为关联字段还是零值的模型加载关联，已加载的关联会继续检查嵌套关联
+func (d *DB) LoadMissing(value any, names ...string) error {
+	return d.load(value, true, names...)
+}
+
+func (d *DB) load(value any, missing bool, names ...string) error {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Ptr {
+		return ErrParam
+	}
+	val = val.Elem()
+
+	var dests []reflect.Value
+	switch val.Kind() {
+	case reflect.Struct:
+		dests = append(dests, val)
+	case reflect.Slice, reflect.Array:
+		// []*User 的元素是模型的指针，跳过 nil
+		for i := 0; i < val.Len(); i++ {
+			dest := reflect.Indirect(val.Index(i))
+			if !dest.IsValid() {
+				continue
+			}
+			if dest.Kind() != reflect.Struct {
+				return ErrParam
+			}
+			dests = append(dests, dest)
+		}
+	default:
+		return ErrParam
+	}
+
+	if len(dests) == 0 {
+		return nil
+	}
+
+	tableInfo := schema.Parse(dests[0].Addr().Interface(), d.dialector, d.TablePrefix)
+
+	for _, name := range names {
+		relationName, childName, _ := strings.Cut(name, ".")
+		if _, ok := tableInfo.Withs[relationName]; !ok {
+			return fmt.Errorf("%w: %s.%s", ErrMissingRelation, tableInfo.Name, relationName)
+		}
+
+		targets := make([]reflect.Value, 0, len(dests))
+		for _, dest := range dests {
+			if !missing || dest.FieldByName(relationName).IsZero() {
+				targets = append(targets, dest)
+			} else if childName != "" {
+				// 已加载的关联继续检查嵌套关联，morphTo 关联的字段中是模型的指针
+				field := dest.FieldByName(relationName)
+				if field.Kind() == reflect.Interface {
+					field = field.Elem()
+				} else {
+					field = field.Addr()
+				}
+
+				if err := d.load(field.Interface(), missing, childName); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(targets) == 0 {
+			continue
+		}
+
+		db := d.ClonePure(1).With(name)
+		withs := db.makeWiths(tableInfo)
+
+		for _, target := range targets {
+			db.getWiths(withs, target)
+		}
+
+		db.relationships(withs)
+
+		if db.Error != nil {
+			return db.Error
+		}
+
+		wg := &sync.WaitGroup{}
+		for _, target := range targets {
+			for _, with := range withs {
+				wg.Add(1)
+				db.setDestRelationship(with, target, wg)
+			}
+		}
+		wg.Wait()
+	}
+
+	return nil
+}
@@ -1,7 +1,9 @@
 package orm
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -49,7 +51,7 @@ func TestBelongsTo(t *testing.T) {
 		UserId uint
 		Mobile string
 		Email  string
-		User   User `db:"localKey:UserId;foreignKey:Id"`
+		User   User `orm:"belongsTo"`
 	}
 
 	var contact = &Contact{}
@@ -60,7 +62,47 @@ func TestBelongsTo(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	fmt.Println(contact.UserId)
+
+	if contact.UserId != 0 && contact.User.Id != contact.UserId {
+		t.Errorf("contact.UserId %d, contact.User.Id %d", contact.UserId, contact.User.Id)
+	}
+	t.Log("contact.User.UserName", contact.User.UserName)
+}
+
+func TestBelongsToKeyType(t *testing.T) {
+	type Author struct {
+		Model
+		Name string
+	}
+
+	// 外键是 int64，作者主键是 uint
+	type Article struct {
+		Model
+		AuthorId int64
+		Title    string
+		Author   Author `orm:"belongsTo"`
+	}
+
+	if err := orm.Migrate.Auto(Author{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := orm.Migrate.Auto(Article{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	article := Article{Title: "hello", Author: Author{Name: "kwin"}}
+	if _, err := orm.With("Author").Create(&article); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Article
+	if err := orm.With("Author").Find(&got, int64(article.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Author.Id == 0 || got.Author.Name != "kwin" {
+		t.Errorf("author %+v", got.Author)
+	}
 }
 
 func TestHasOneCreate(t *testing.T) {
@@ -135,3 +177,610 @@ func TestHasOneUpdate(t *testing.T) {
 
 	fmt.Printf("%#v %#v\n", res, err)
 }
+
+func TestManyToMany(t *testing.T) {
+	type UserRoles struct {
+		UserId uint
+		RoleId uint
+		Level  int
+	}
+
+	type Role struct {
+		Model
+		Name  string
+		Pivot UserRoles `orm:"pivot"`
+	}
+
+	type User struct {
+		Model
+		UserName string
+		Roles    []Role `orm:"many2many:user_roles;joinForeignKey:user_id;joinReferences:role_id"`
+	}
+
+	for _, model := range []any{Role{}, UserRoles{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := &User{
+		UserName: "kwinwong",
+		Roles:    []Role{{Name: "admin", Pivot: UserRoles{Level: 3}}, {Name: "dev"}},
+	}
+
+	if _, err := orm.With("Roles").Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	result := &User{}
+	if err := orm.With("Roles").Find(result, int64(user.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Roles) != 2 {
+		t.Fatalf("roles %d", len(result.Roles))
+	}
+
+	for _, role := range result.Roles {
+		if role.Name == "admin" && role.Pivot.Level != 3 {
+			t.Errorf("pivot level %d", role.Pivot.Level)
+		}
+	}
+
+	user.Roles = user.Roles[1:]
+	if _, err := orm.With("Roles").Update(user); err != nil {
+		t.Fatal(err)
+	}
+
+	result = &User{}
+	if err := orm.With("Roles").Find(result, int64(user.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Roles) != 1 || result.Roles[0].Name != "dev" {
+		t.Errorf("roles %+v", result.Roles)
+	}
+}
+
+func TestAssociation(t *testing.T) {
+	type Contact struct {
+		Model
+		UserId uint
+		Mobile string
+	}
+
+	type User struct {
+		Model
+		UserName string
+		Contact  []Contact
+	}
+
+	user := &User{UserName: "kwinwong"}
+	if _, err := orm.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	association := orm.Association(user, "Contact")
+
+	first, second := &Contact{Mobile: "13758665977"}, &Contact{Mobile: "13589217699"}
+	if err := association.Append(first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if first.UserId != user.Id || len(user.Contact) != 2 {
+		t.Errorf("contact.UserId %d, user.Contact %d", first.UserId, len(user.Contact))
+	}
+
+	if err := association.Delete(first); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := association.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Errorf("count %d", count)
+	}
+
+	if err = association.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	if count, _ = association.Count(); count != 0 {
+		t.Errorf("count %d", count)
+	}
+}
+
+func TestAssociation_MissingRelation(t *testing.T) {
+	type User struct {
+		Model
+		UserName string
+	}
+
+	user := &User{UserName: "kwinwong"}
+	association := orm.Association(user, "Nope")
+
+	if err := association.Append(&User{}); !errors.Is(err, ErrMissingRelation) {
+		t.Errorf("Append err %v", err)
+	}
+
+	if err := association.Clear(); !errors.Is(err, ErrMissingRelation) {
+		t.Errorf("Clear err %v", err)
+	}
+
+	if err := association.Detach(1); !errors.Is(err, ErrMissingRelation) {
+		t.Errorf("Detach err %v", err)
+	}
+}
+
+func TestWhereHas(t *testing.T) {
+	type Contact struct {
+		Model
+		UserId uint
+		Mobile string
+	}
+
+	type User struct {
+		Model
+		UserName string
+		Contact  []Contact
+	}
+
+	var users []User
+	err := orm.WhereHas("Contact", func(query *DB) {
+		query.Where("mobile", "13758665977")
+	}).Get(&users)
+
+	if err != nil && err != ErrNotFind {
+		t.Fatal(err)
+	}
+
+	for _, user := range users {
+		result := &User{}
+		if err = orm.With("Contact").Find(result, int64(user.Id)); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result.Contact) == 0 {
+			t.Errorf("user %d has no contact", user.Id)
+		}
+	}
+
+	count, err := orm.Model(&User{}).DoesntHave("Contact").Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("user without contact", count)
+}
+
+func TestOrWhereHas_Order(t *testing.T) {
+	type Contact struct {
+		Model
+		UserId uint
+		Mobile string
+	}
+
+	type User struct {
+		Model
+		UserName string
+		Contact  []Contact
+	}
+
+	// 关联条件按调用顺序拼接，不会移到其他条件之后
+	sql, _ := orm.Model(&User{}).Where("user_name", "a").OrWhereHas("Contact", nil).Where("user_name", "b").ToSql()
+	if !strings.Contains(sql, "WHERE `user_name` = ? OR EXISTS (") || !strings.HasSuffix(sql, ") AND `user_name` = ?") {
+		t.Errorf("sql %s", sql)
+	}
+}
+
+func TestWhereHas_Self(t *testing.T) {
+	type Category struct {
+		Model
+		Name          string
+		ParentId      uint
+		Children      []Category `orm:"foreignKey:parent_id"`
+		ChildrenCount int64      `orm:"aggregate"`
+	}
+
+	if err := orm.Migrate.Auto(Category{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	root := &Category{Name: "root"}
+	if _, err := orm.Create(root); err != nil {
+		t.Fatal(err)
+	}
+
+	children := []Category{{Name: "a", ParentId: root.Id}, {Name: "b", ParentId: root.Id}}
+	if _, err := orm.Create(&children); err != nil {
+		t.Fatal(err)
+	}
+
+	var categories []Category
+	if err := orm.Has("Children").WithCount("Children").Get(&categories); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(categories) != 1 || categories[0].Id != root.Id || categories[0].ChildrenCount != 2 {
+		t.Errorf("categories %+v", categories)
+	}
+}
+
+func TestWithCount(t *testing.T) {
+	type Contact struct {
+		Model
+		UserId uint
+		Mobile string
+	}
+
+	type User struct {
+		Model
+		UserName     string
+		Contact      []Contact
+		ContactCount int64
+		ContactMaxId int64
+		MobileCount  int64 `orm:"aggregate:mobile_count"`
+	}
+
+	var users []User
+	err := orm.WithCount("Contact").
+		WithMax("Contact", "id").
+		WithCount("Contact as mobile_count", func(query *DB) {
+			query.Where("mobile", "13758665977")
+		}).
+		With("Contact").
+		Get(&users)
+
+	if err != nil && err != ErrNotFind {
+		t.Fatal(err)
+	}
+
+	for _, user := range users {
+		if user.ContactCount != int64(len(user.Contact)) {
+			t.Errorf("user %d contact count %d, contacts %d", user.Id, user.ContactCount, len(user.Contact))
+		}
+
+		if user.ContactCount > 0 && user.ContactMaxId == 0 {
+			t.Errorf("user %d contact max id %d", user.Id, user.ContactMaxId)
+		}
+
+		if user.MobileCount > user.ContactCount {
+			t.Errorf("user %d mobile count %d", user.Id, user.MobileCount)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	type Contact struct {
+		Model
+		UserId uint
+		Mobile string
+	}
+
+	type User struct {
+		Model
+		UserName string
+		Contact  []Contact
+	}
+
+	var users []User
+	err := orm.Get(&users)
+	if err != nil {
+		if err == ErrNotFind {
+			return
+		}
+		t.Fatal(err)
+	}
+
+	if err = orm.Load(&users, "Contact"); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make([]int, len(users))
+	for i, user := range users {
+		counts[i] = len(user.Contact)
+	}
+
+	if err = orm.LoadMissing(&users, "Contact"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, user := range users {
+		if len(user.Contact) != counts[i] {
+			t.Errorf("user %d contact reloaded", user.Id)
+		}
+	}
+
+	if err = orm.Load(&users, "Missing"); !errors.Is(err, ErrMissingRelation) || !strings.Contains(err.Error(), "User.Missing") {
+		t.Errorf("load missing relation %v", err)
+	}
+
+	pointers := make([]*User, 0, len(users)+1)
+	for i := range users {
+		users[i].Contact = nil
+		pointers = append(pointers, &users[i])
+	}
+	pointers = append(pointers, nil)
+
+	if err = orm.Load(&pointers, "Contact"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, user := range users {
+		if len(user.Contact) != counts[i] {
+			t.Errorf("user %d contact %d, want %d", user.Id, len(user.Contact), counts[i])
+		}
+	}
+}
+
+func TestPolymorphic(t *testing.T) {
+	type Comment struct {
+		Model
+		Body            string
+		CommentableId   uint
+		CommentableType string
+		Commentable     any `orm:"polymorphic:Commentable"`
+	}
+
+	type Post struct {
+		Model
+		Title    string
+		Comments []Comment `orm:"polymorphic:Commentable"`
+	}
+
+	type Video struct {
+		Model
+		Name     string
+		Comments []Comment `orm:"polymorphic:Commentable"`
+	}
+
+	RegisterMorph("post", &Post{})
+	RegisterMorph("video", &Video{})
+
+	for _, model := range []any{Comment{}, Post{}, Video{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	post := &Post{Title: "hello", Comments: []Comment{{Body: "a"}, {Body: "b"}}}
+	if _, err := orm.With("Comments").Create(post); err != nil {
+		t.Fatal(err)
+	}
+
+	if post.Comments[0].CommentableType != "post" {
+		t.Errorf("commentable type %s", post.Comments[0].CommentableType)
+	}
+
+	comment := &Comment{Body: "c", Commentable: &Video{Name: "v"}}
+	if _, err := orm.With("Commentable").Create(comment); err != nil {
+		t.Fatal(err)
+	}
+
+	if comment.CommentableType != "video" || comment.CommentableId == 0 {
+		t.Errorf("commentable %s %d", comment.CommentableType, comment.CommentableId)
+	}
+
+	result := &Post{}
+	if err := orm.With("Comments").Find(result, int64(post.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Comments) != 2 {
+		t.Errorf("comments %d", len(result.Comments))
+	}
+
+	var comments []Comment
+	err := orm.With("Commentable").
+		WhereIn("id", post.Comments[0].Id, comment.Id).
+		Get(&comments)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range comments {
+		switch commentable := c.Commentable.(type) {
+		case *Post:
+			if commentable.Id != post.Id {
+				t.Errorf("post %d", commentable.Id)
+			}
+		case *Video:
+			if commentable.Name != "v" {
+				t.Errorf("video %s", commentable.Name)
+			}
+		default:
+			t.Errorf("commentable %T", commentable)
+		}
+	}
+}
+
+func TestHasManyThrough(t *testing.T) {
+	type Article struct {
+		Model
+		MemberId uint
+		Title    string
+	}
+
+	type Member struct {
+		Model
+		CountryId uint
+		Name      string
+	}
+
+	type Country struct {
+		Model
+		Name     string
+		Articles []Article `orm:"through:member;throughForeignKey:country_id;foreignKey:member_id"`
+	}
+
+	for _, model := range []any{Article{}, Member{}, Country{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	country := &Country{Name: "china"}
+	if _, err := orm.Create(country); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := &Member{CountryId: country.Id, Name: "a"}, &Member{CountryId: country.Id, Name: "b"}
+	if _, err := orm.Create(first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	articles := []Article{{MemberId: first.Id, Title: "a1"}, {MemberId: first.Id, Title: "a2"}, {MemberId: second.Id, Title: "b1"}}
+	if _, err := orm.Create(&articles); err != nil {
+		t.Fatal(err)
+	}
+
+	result := &Country{}
+	if err := orm.With("Articles").Find(result, int64(country.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Articles) != 3 {
+		t.Errorf("articles %d", len(result.Articles))
+	}
+
+	result = &Country{}
+	err := orm.With("Articles", func(query *DB) {
+		query.Where("article.title", "b1")
+	}).Find(result, int64(country.Id))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Articles) != 1 {
+		t.Errorf("articles %d", len(result.Articles))
+	}
+}
+
+func TestHasManyThrough_Model(t *testing.T) {
+	type Entry struct {
+		Model
+		RegionMemberId uint
+		Title          string
+	}
+
+	type RegionMember struct {
+		Model
+		RegionId uint
+		Name     string
+	}
+
+	type Region struct {
+		Model
+		Name    string
+		Entries []Entry `orm:"through:region_member;throughForeignKey:region_id"`
+	}
+
+	for _, model := range []any{Entry{}, RegionMember{}, Region{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 解析 Region 之后才注册中间模型，查询时仍然使用中间模型
+	RegisterModel("region_member", &RegionMember{})
+
+	region := &Region{Name: "east"}
+	if _, err := orm.Create(region); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := &RegionMember{RegionId: region.Id, Name: "a"}, &RegionMember{RegionId: region.Id, Name: "b"}
+	if _, err := orm.Create(first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []Entry{{RegionMemberId: first.Id, Title: "a1"}, {RegionMemberId: second.Id, Title: "b1"}}
+	if _, err := orm.Create(&entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// 软删除的中间模型不再关联
+	if _, err := orm.Delete(second); err != nil {
+		t.Fatal(err)
+	}
+
+	result := &Region{}
+	if err := orm.With("Entries").Find(result, int64(region.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Entries) != 1 || result.Entries[0].Title != "a1" {
+		t.Errorf("entries %+v", result.Entries)
+	}
+}
+
+func TestCascadeDelete(t *testing.T) {
+	type Invoice struct {
+		Model
+		ShopperId uint
+		Amount    int
+	}
+
+	type Note struct {
+		Id        uint `orm:"autoIncrement"`
+		ShopperId uint
+	}
+
+	type Shopper struct {
+		Model
+		Name     string
+		Invoices []Invoice `orm:"onDelete:cascade"`
+		Notes    []Note    `orm:"onDelete:restrict"`
+	}
+
+	for _, model := range []any{Invoice{}, Note{}, Shopper{}} {
+		if err := orm.Migrate.Auto(model, true, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shopper := &Shopper{Name: "kwinwong", Invoices: []Invoice{{Amount: 1}, {Amount: 2}}}
+	if _, err := orm.With("Invoices").Create(shopper); err != nil {
+		t.Fatal(err)
+	}
+
+	invoices := func() int64 {
+		count, err := orm.Table("invoice").Where("shopper_id", shopper.Id).WhereNull("deleted_at").Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	if _, err := orm.Delete(shopper); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := invoices(); count != 0 {
+		t.Errorf("invoices %d after delete", count)
+	}
+
+	if _, err := orm.Restore(shopper); err != nil {
+		t.Fatal(err)
+	}
+
+	if count := invoices(); count != 2 {
+		t.Errorf("invoices %d after restore", count)
+	}
+
+	if _, err := orm.Create(&Note{ShopperId: shopper.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := orm.Delete(shopper); !errors.Is(err, ErrDeleteRestricted) {
+		t.Errorf("expected restricted, got %v", err)
+	}
+
+	if count := invoices(); count != 2 {
+		t.Errorf("invoices %d after restricted delete", count)
+	}
+}
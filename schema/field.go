@@ -33,7 +33,9 @@ type Field struct {
 	Raw             bool
 	Decimal         string
 	IsJson          bool
-	Value           any
+	// SoftDelete 软删除字段的处理方式，不是软删除字段时为空
+	SoftDelete SoftDeleteType
+	Value      any
 }
 
 const (
@@ -65,11 +67,27 @@ func parseField(p reflect.StructField, dialect IDialect, schema *Schema, isAnony
 			TagSettings: tagSettings,
 		}
 
+		// 中间表数据不是当前表的字段，查询多对多关联时再填充
+		if _, ok := tagSettings["pivot"]; ok {
+			schema.PivotField = p.Name
+			return
+		}
+
+		// 关联聚合的结果不是当前表的字段，例如 `orm:"aggregate"` 接收 WithCount("Orders") 的 orders_count
+		if alias, ok := tagSettings["aggregate"]; ok {
+			if alias != "" {
+				field.FieldName = alias
+			}
+			schema.Aggregates[field.FieldName] = field
+			return
+		}
+
 		parseTag(field, schema)
 
 		if !field.IsJson {
 			with := MakeWith(p, dialect, tagSettings, schema)
 			if with != nil {
+				with.OnDelete = tagSettings["onDelete"]
 				schema.Withs[p.Name] = with
 				return
 			}
@@ -77,6 +95,8 @@ func parseField(p reflect.StructField, dialect IDialect, schema *Schema, isAnony
 
 		setDataType(field)
 		setSize(field)
+		setSoftDelete(field, schema)
+		setVersion(field, schema)
 
 		if field.Raw {
 			schema.FieldNames = append(schema.FieldNames, sqlBuilder.Raw(field.FieldName))
@@ -252,6 +272,19 @@ func setDataType(field *Field) {
 	}
 }
 
+// setVersion 带 version 标签的整数字段为乐观锁的版本号字段
+func setVersion(field *Field, schema *Schema) {
+	if _, ok := field.TagSettings["version"]; !ok {
+		return
+	}
+
+	if field.DataType != Int && field.DataType != Uint {
+		log.Printf("Invalid version field %s: %s", field.Name, field.StructField.Type.Kind())
+		return
+	}
+	schema.Version = field
+}
+
 func setSize(field *Field) {
 	if field.Size == 0 {
 		switch field.StructField.Type.Kind() {
@@ -13,6 +13,57 @@ type IDialect interface {
 	Migrate(IDBParse) IMigrator
 }
 
+// IRebind go-sql-builder 生成的是 mysql 风格的语句，占位符、标识符引用不同的方言需要实现
+type IRebind interface {
+	Rebind(sql string) string
+}
+
+// IReturning 不支持 LastInsertId 的方言，通过返回的子句取回插入的主键
+type IReturning interface {
+	Returning(field *Field) string
+}
+
+// IConflict 不支持 REPLACE、ON DUPLICATE KEY UPDATE 的方言，将其改写为自身的冲突处理语句
+type IConflict interface {
+	Conflict(sql string, conflict []string) string
+}
+
+// IUpsert 不支持 ON DUPLICATE KEY UPDATE、INSERT IGNORE 的方言，在 INSERT 语句上加上自身的冲突处理，
+// columns 为判断冲突的字段，update 为冲突时更新的字段
+type IUpsert interface {
+	Upsert(sql string, columns []string, update []string, doNothing bool) string
+}
+
+// IRetry 判断错误是否为死锁、锁等待超时、序列化失败等可以重试整个事务的错误
+type IRetry interface {
+	Retryable(err error) bool
+}
+
+// ILock 支持行锁的方言，返回追加在查询语句之后的加锁子句，不支持行锁的方言不需要实现
+type ILock interface {
+	Lock(strength LockStrength, option LockOption) string
+}
+
+// LockStrength 行锁的类型
+type LockStrength string
+
+const (
+	// LockUpdate 排他锁
+	LockUpdate LockStrength = "update"
+	// LockShare 共享锁
+	LockShare LockStrength = "share"
+)
+
+// LockOption 无法立即取得行锁时的处理方式，为空时等待锁释放
+type LockOption string
+
+const (
+	// LockSkipLocked 跳过已经被锁定的行
+	LockSkipLocked LockOption = "skipLocked"
+	// LockNoWait 不等待，直接返回错误
+	LockNoWait LockOption = "noWait"
+)
+
 type ITableName interface {
 	TableName() string
 }
@@ -0,0 +1,46 @@
+package schema
+
+import (
+	"reflect"
+	"sync"
+)
+
+var morphs = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+}
+
+// RegisterMorph 注册多态关联类型字段的值对应的模型
+func RegisterMorph(name string, model any) {
+	modelType := reflect.TypeOf(model)
+	for modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	morphs.Lock()
+	defer morphs.Unlock()
+	morphs.types[name] = modelType
+	morphs.names[modelType] = name
+}
+
+// MorphModel 返回类型字段的值对应的模型类型
+func MorphModel(name string) (reflect.Type, bool) {
+	morphs.RLock()
+	defer morphs.RUnlock()
+	modelType, ok := morphs.types[name]
+	return modelType, ok
+}
+
+// MorphName 返回模型写入类型字段的值，没有注册时为表名
+func MorphName(schema *Schema) string {
+	morphs.RLock()
+	defer morphs.RUnlock()
+	if name, ok := morphs.names[schema.Type]; ok {
+		return name
+	}
+	return schema.TableName
+}
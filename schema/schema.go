@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,6 +14,13 @@ type WithType uint
 const (
 	One WithType = iota
 	Many
+	BelongsTo
+	ManyToMany
+	MorphOne
+	MorphMany
+	MorphTo
+	HasOneThrough
+	HasManyThrough
 )
 
 type IndexType string
@@ -24,7 +32,19 @@ const (
 	FULLTEXTKEY IndexType = "FULLTEXT KEY"
 )
 
-var schemas = make(map[string]*Schema)
+type cacheKey struct {
+	key       string
+	modelType reflect.Type
+}
+
+var (
+	// schemas 解析完成的模型，schemasMu 保护并发读写
+	schemas   = make(map[cacheKey]*Schema)
+	schemasMu sync.RWMutex
+	// parsing 正在解析的模型，关联模型递归解析时可以拿到当前模型，只在持有 parseMu 时访问
+	parsing = make(map[cacheKey]*Schema)
+	parseMu sync.Mutex
+)
 
 type Index struct {
 	Priority int
@@ -51,6 +71,14 @@ type Schema struct {
 	UniqueKeys  IndexList
 	FullKeys    IndexList
 	ExtendModel bool
+	// PivotField 多对多关联时接收中间表字段的结构体字段名
+	PivotField string
+	// Aggregates 接收关联聚合结果的字段，键为查询结果的列名
+	Aggregates map[string]*Field
+	// SoftDelete 软删除字段，为 nil 时不支持软删除
+	SoftDelete *Field
+	// Version 乐观锁的版本号字段，为 nil 时不使用乐观锁
+	Version *Field
 }
 
 // GetField returns field by name
@@ -180,29 +208,91 @@ func (schema *Schema) getDefaultFieldValue(field *Field, defaultValue any) any {
 }
 
 // Parse a struct to a Schema instance
+// 返回缓存的副本，Value 指向 dest，并发调用时不会互相覆盖
 func Parse(dest any, dialect IDialect, tablePrefix string) *Schema {
 	modelValue := reflect.Indirect(reflect.ValueOf(dest))
-	modelType := modelValue.Type()
-	firstType := modelType
+	key, modelType := parseKey(modelValue, dialect, tablePrefix)
+
+	schemasMu.RLock()
+	cached, ok := schemas[key]
+	schemasMu.RUnlock()
+
+	if !ok {
+		cached = parseAndCache(key, modelValue, modelType, dialect, tablePrefix)
+	}
+
+	schema := *cached
+	schema.Value = modelValue
+	return &schema
+}
+
+// parseAndCache 同一时间只解析一个模型，解析完成后连同递归解析的关联模型一起放入缓存
+func parseAndCache(key cacheKey, modelValue reflect.Value, modelType reflect.Type, dialect IDialect, tablePrefix string) *Schema {
+	parseMu.Lock()
+	defer parseMu.Unlock()
+	defer func() {
+		parsing = make(map[cacheKey]*Schema)
+	}()
+
+	schema := parse(key, modelValue, modelType, dialect, tablePrefix)
+
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	for k, v := range parsing {
+		schemas[k] = v
+	}
+	return schema
+}
 
+// parseKey 不同的结构体可能对应同一张表，缓存需要区分类型
+func parseKey(modelValue reflect.Value, dialect IDialect, tablePrefix string) (cacheKey, reflect.Type) {
+	modelType := modelValue.Type()
 	if modelType.Kind() == reflect.Slice || modelType.Kind() == reflect.Array || modelType.Kind() == reflect.Ptr {
 		modelType = modelType.Elem()
 	}
 
-	model := reflect.New(modelType).Interface()
-	tableName := getTableName(model, tablePrefix)
+	tableName := getTableName(reflect.New(modelType).Interface(), tablePrefix)
+	return cacheKey{
+		key:       dialect.Name() + dialect.GetDSN() + tablePrefix + tableName,
+		modelType: modelType,
+	}, modelType
+}
+
+// parseWith 解析关联模型，调用方持有 parseMu，返回的是缓存中的模型
+func parseWith(dest any, dialect IDialect, tablePrefix string) *Schema {
+	modelValue := reflect.Indirect(reflect.ValueOf(dest))
+	key, modelType := parseKey(modelValue, dialect, tablePrefix)
+
+	schemasMu.RLock()
+	cached, ok := schemas[key]
+	schemasMu.RUnlock()
+
+	if ok {
+		return cached
+	}
+	return parse(key, modelValue, modelType, dialect, tablePrefix)
+}
 
-	cacheKey := dialect.Name() + dialect.GetDSN() + tablePrefix + tableName
-	if schema, ok := schemas[cacheKey]; ok {
-		schema.Value = modelValue
+func parse(key cacheKey, modelValue reflect.Value, modelType reflect.Type, dialect IDialect, tablePrefix string) *Schema {
+	if schema, ok := parsing[key]; ok {
 		return schema
 	}
 
-	schema := createSchema(tablePrefix, modelValue, firstType, modelType, model, tableName)
+	schemasMu.RLock()
+	cached, ok := schemas[key]
+	schemasMu.RUnlock()
+	if ok {
+		return cached
+	}
+
+	model := reflect.New(modelType).Interface()
+	schema := createSchema(tablePrefix, modelValue, modelValue.Type(), modelType, model, getTableName(model, tablePrefix))
+
+	// 先放入解析中的模型，模型之间互相关联时解析关联模型可以拿到当前模型
+	parsing[key] = schema
 
 	parseStructFields(schema, modelType, dialect)
 
-	schemas[cacheKey] = schema
 	return schema
 }
 
@@ -224,6 +314,7 @@ func createSchema(tablePrefix string, modelValue reflect.Value, firstType, model
 		TableName:   tableName,
 		fieldMap:    make(map[string]*Field),
 		Withs:       make(map[string]*With),
+		Aggregates:  make(map[string]*Field),
 		IndexKeys:   make(IndexList),
 		UniqueKeys:  make(IndexList),
 		FullKeys:    make(IndexList),
@@ -231,14 +322,89 @@ func createSchema(tablePrefix string, modelValue reflect.Value, firstType, model
 }
 
 func parseStructFields(schema *Schema, modelType reflect.Type, dialect IDialect) {
+	if modelType.Kind() != reflect.Struct {
+		return
+	}
+
+	withFields := make([]reflect.StructField, 0)
 	for i := 0; i < modelType.NumField(); i++ {
 		field := modelType.Field(i)
 		if field.Anonymous {
 			parseAnonymousField(schema, field, dialect)
+		} else if isWithField(field) {
+			withFields = append(withFields, field)
 		} else {
 			parseField(field, dialect, schema, false)
 		}
 	}
+
+	// 关联字段需要用到当前模型的主键、外键，等其它字段解析完后再解析
+	for _, field := range withFields {
+		parseField(field, dialect, schema, false)
+	}
+
+	parseAggregateFields(schema)
+}
+
+// aggregateFunctions 关联聚合的函数名，字段名为 关联名+函数名(+字段名) 时接收聚合结果
+var aggregateFunctions = []string{"Count", "Sum", "Avg", "Max", "Min"}
+
+// parseAggregateFields 没有 orm 标签的数值字段按命名约定接收关联聚合的结果，不是当前表的字段，
+// 例如 OrdersCount 接收 WithCount("Orders")，OrdersSumAmount 接收 WithSum("Orders", "amount")；
+// 需要作为表字段时给字段加上 orm 标签，`orm:"aggregate:列名"` 可以指定接收的列名
+func parseAggregateFields(schema *Schema) {
+	fields := make([]*Field, 0, len(schema.Fields))
+	fieldNames := make([]any, 0, len(schema.FieldNames))
+
+	for _, field := range schema.Fields {
+		if field.TagSettings == nil && isAggregateField(field, schema.Withs) {
+			delete(schema.fieldMap, field.FieldName)
+			delete(schema.fieldMap, field.Name)
+			schema.Aggregates[field.FieldName] = field
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) == len(schema.Fields) {
+		return
+	}
+
+	for _, name := range schema.FieldNames {
+		if fieldName, ok := name.(string); !ok || schema.fieldMap[fieldName] != nil {
+			fieldNames = append(fieldNames, name)
+		}
+	}
+
+	schema.Fields = fields
+	schema.FieldNames = fieldNames
+}
+
+// isAggregateField 字段名是否为 关联名+聚合函数名，Count 之后不能再有字段名，其它函数之后必须有字段名
+func isAggregateField(field *Field, withs map[string]*With) bool {
+	switch field.DataType {
+	case Int, Uint, Float:
+	default:
+		return false
+	}
+
+	for name := range withs {
+		suffix, ok := strings.CutPrefix(field.Name, name)
+		if !ok {
+			continue
+		}
+
+		for _, function := range aggregateFunctions {
+			if function == "Count" {
+				if suffix == function {
+					return true
+				}
+			} else if len(suffix) > len(function) && strings.HasPrefix(suffix, function) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func parseAnonymousField(schema *Schema, field reflect.StructField, dialect IDialect) {
@@ -0,0 +1,82 @@
+package schema
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+type SoftDeleteType string
+
+const (
+	// SoftDeleteTime 删除时写入当前时间，未删除时为 NULL
+	SoftDeleteTime SoftDeleteType = "time"
+	// SoftDeleteUnix 删除时写入秒级时间戳，未删除时为 0
+	SoftDeleteUnix SoftDeleteType = "unix"
+	// SoftDeleteMilli 删除时写入毫秒级时间戳，未删除时为 0
+	SoftDeleteMilli SoftDeleteType = "milli"
+	// SoftDeleteFlag 删除时写入 1，未删除时为 0
+	SoftDeleteFlag SoftDeleteType = "flag"
+)
+
+// setSoftDelete 带 softDelete 标签的字段为软删除字段，没有声明时 DeletedAt 字段按时间处理，
+// 不支持的软删除方式直接 panic，避免删除时变成物理删除
+func setSoftDelete(field *Field, schema *Schema) {
+	if v, ok := field.TagSettings["softDelete"]; ok {
+		softDelete := SoftDeleteType(v)
+		switch softDelete {
+		case "":
+			softDelete = SoftDeleteTime
+		case SoftDeleteTime, SoftDeleteUnix, SoftDeleteMilli, SoftDeleteFlag:
+		default:
+			panic(fmt.Sprintf("orm: invalid soft delete type %q for field %s.%s", v, schema.Name, field.Name))
+		}
+
+		field.SoftDelete = softDelete
+		schema.SoftDelete = field
+		return
+	}
+
+	if field.Name == "DeletedAt" && (schema.SoftDelete == nil || schema.SoftDelete.Name == "DeletedAt") {
+		field.SoftDelete = SoftDeleteTime
+		schema.SoftDelete = field
+	}
+}
+
+// DeletedValue 软删除时写入的值
+func (field *Field) DeletedValue() any {
+	now := time.Now()
+	switch field.SoftDelete {
+	case SoftDeleteUnix:
+		return now.Unix()
+	case SoftDeleteMilli:
+		return now.UnixMilli()
+	case SoftDeleteFlag:
+		return 1
+	default:
+		return formatTime(now, 3)
+	}
+}
+
+// Trashed 模型的软删除字段是否为已删除的值，value 为模型的结构体
+func (field *Field) Trashed(value reflect.Value) bool {
+	fieldValue := value.FieldByName(field.Name)
+	if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
+		return false
+	}
+
+	if valuer, ok := fieldValue.Interface().(driver.Valuer); ok {
+		v, err := valuer.Value()
+		return err == nil && v != nil
+	}
+	return !fieldValue.IsZero()
+}
+
+// RestoreValue 未删除时的值
+func (field *Field) RestoreValue() any {
+	if field.SoftDelete == SoftDeleteTime {
+		return nil
+	}
+	return 0
+}
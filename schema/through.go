@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"reflect"
+	"sync"
+)
+
+var models = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}{
+	types: make(map[string]reflect.Type),
+}
+
+// RegisterModel 注册模型的名称，远程关联的 through 标签通过名称找到中间模型
+func RegisterModel(name string, model any) {
+	modelType := reflect.TypeOf(model)
+	for modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	models.Lock()
+	defer models.Unlock()
+	models.types[name] = modelType
+}
+
+// RegisteredModel 返回名称对应的模型类型
+func RegisteredModel(name string) (reflect.Type, bool) {
+	models.RLock()
+	defer models.RUnlock()
+	modelType, ok := models.types[name]
+	return modelType, ok
+}
+
+// makeThrough 通过中间模型的远程关联，例如 Country.Id 关联 user.country_id，user.id 关联 Post.UserId；
+// through 为 RegisterModel 注册的模型名称时，中间表及其关联字段的默认值取自中间模型，否则作为中间表的表名。
+// 解析时 through 还没有注册的，查询前由 ResolveThrough 按之后注册的中间模型重新生成
+func makeThrough(with *With, through string, dialect IDialect, tagSettings map[string]string, schema1 *Schema) *With {
+	if through == "" {
+		return nil
+	}
+
+	if with.Type == Many {
+		with.Type = HasManyThrough
+	} else {
+		with.Type = HasOneThrough
+	}
+
+	localKey, ok := tagSettings["localKey"]
+	if ok {
+		with.LocalKey = schema1.GetField(localKey)
+	} else {
+		with.LocalKey = schema1.PrimaryKey
+	}
+
+	if with.LocalKey == nil {
+		return nil
+	}
+
+	with.JoinForeignKey, ok = tagSettings["throughForeignKey"]
+	if !ok {
+		with.JoinForeignKey = schema1.TableName + "_" + with.LocalKey.FieldName
+	}
+
+	with.through = &throughSetting{
+		name:        through,
+		dialect:     dialect,
+		tablePrefix: schema1.TablePrefix,
+		tagSettings: tagSettings,
+	}
+
+	_, registered := RegisteredModel(through)
+	if !with.through.resolve(with) && registered {
+		return nil
+	}
+	return with
+}
+
+// throughSetting 远程关联的 through 标签，用于查询时按之后注册的中间模型重新生成关联
+type throughSetting struct {
+	name        string
+	dialect     IDialect
+	tablePrefix string
+	tagSettings map[string]string
+}
+
+// resolve 按 through 生成中间表及关联字段，找不到中间模型的主键或关联模型的外键时返回 false
+func (t *throughSetting) resolve(with *With) bool {
+	// 中间模型的主键，through 为表名时默认为 id
+	throughKey := "id"
+	with.JoinTable = t.name
+	with.Through = nil
+
+	if modelType, ok := RegisteredModel(t.name); ok {
+		with.Through = parseWith(reflect.New(modelType).Interface(), t.dialect, t.tablePrefix)
+		if with.Through.PrimaryKey == nil {
+			return false
+		}
+		with.JoinTable = with.Through.TableName
+		throughKey = with.Through.PrimaryKey.FieldName
+	}
+
+	foreignKey, ok := t.tagSettings["foreignKey"]
+	if !ok {
+		foreignKey = with.JoinTable + "_" + throughKey
+	}
+	with.ForeignKey = with.Schema.GetField(foreignKey)
+
+	with.JoinReferences, ok = t.tagSettings["throughLocalKey"]
+	if !ok {
+		with.JoinReferences = throughKey
+	}
+
+	return with.ForeignKey != nil
+}
+
+// ResolveThrough 返回查询时使用的关联：解析模型时 through 还没有注册、之后才注册为模型的远程关联，
+// 按中间模型重新生成；仍然找不到关联字段时返回 nil，其他关联原样返回
+func (with *With) ResolveThrough() *With {
+	if with.through == nil || with.Through != nil {
+		return with
+	}
+
+	if _, ok := RegisteredModel(with.through.name); !ok {
+		if with.ForeignKey == nil {
+			return nil
+		}
+		return with
+	}
+
+	w := *with
+	if !w.through.resolve(&w) {
+		return nil
+	}
+	return &w
+}
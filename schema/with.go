@@ -1,20 +1,62 @@
 package schema
 
 import (
+	"go/ast"
 	"reflect"
 )
 
 type With struct {
-	ModelType     reflect.Type
-	Type          WithType
-	Schema        *Schema
-	Name          string
-	LocalKey      *Field
-	ForeignKey    *Field
+	ModelType  reflect.Type
+	Type       WithType
+	Schema     *Schema
+	Name       string
+	LocalKey   *Field
+	ForeignKey *Field
+	// 多对多关联的中间表及其字段，远程关联时为中间模型的表及其字段
+	JoinTable      string
+	JoinForeignKey string
+	JoinReferences string
+	// Through 远程关联的中间模型，through 标签为表名时为 nil
+	Through *Schema
+	through *throughSetting
+	// 多态关联的类型字段，morphOne、morphMany 在关联模型上，morphTo 在当前模型上
+	MorphType *Field
+	// MorphValue 多态关联写入类型字段的值，查询时根据当前模型确定
+	MorphValue string
+	// OnDelete 删除当前模型时对关联模型的处理：cascade、restrict、setNull
+	OnDelete      string
 	Values        []any
 	Relationships map[any][]reflect.Value
 }
 
+// isWithField 字段类型是否可能是关联模型
+func isWithField(p reflect.StructField) bool {
+	if !ast.IsExported(p.Name) {
+		return false
+	}
+
+	pType := p.Type
+	if pType.Kind() == reflect.Slice {
+		pType = pType.Elem()
+	}
+
+	// morphTo 关联的模型类型不固定，使用接口类型的字段接收
+	if p.Type.Kind() == reflect.Interface {
+		_, ok := ParseTagSetting(p.Tag.Get("orm"), ";")["polymorphic"]
+		return ok
+	}
+
+	if pType.Kind() != reflect.Struct {
+		return false
+	}
+
+	switch pType.String() {
+	case "time.Time", "sql.NullTime":
+		return false
+	}
+	return true
+}
+
 func MakeWith(p reflect.StructField, dialect IDialect, tagSettings map[string]string, schema1 *Schema) *With {
 
 	pType := p.Type
@@ -25,11 +67,10 @@ func MakeWith(p reflect.StructField, dialect IDialect, tagSettings map[string]st
 		pType = pType.Elem()
 	}
 
-	if pType.Kind() == reflect.Struct {
+	if isWithField(p) {
 
-		switch pType.String() {
-		case "time.Time", "sql.NullTime":
-			return nil
+		if pType.Kind() == reflect.Interface {
+			return makeMorphTo(p, tagSettings, schema1)
 		}
 
 		with := &With{
@@ -37,7 +78,29 @@ func MakeWith(p reflect.StructField, dialect IDialect, tagSettings map[string]st
 			Name:          p.Name,
 			ModelType:     pType,
 			Relationships: make(map[any][]reflect.Value, 0),
-			Schema:        Parse(reflect.New(pType).Interface(), dialect, schema1.TablePrefix),
+			Schema:        parseWith(reflect.New(pType).Interface(), dialect, schema1.TablePrefix),
+		}
+
+		if joinTable, ok := tagSettings["many2many"]; ok {
+			if withType != Many {
+				return nil
+			}
+			return makeManyToMany(with, joinTable, tagSettings, schema1)
+		}
+
+		if through, ok := tagSettings["through"]; ok {
+			return makeThrough(with, through, dialect, tagSettings, schema1)
+		}
+
+		if name, ok := tagSettings["polymorphic"]; ok {
+			return makePolymorphic(with, name, tagSettings, schema1)
+		}
+
+		if _, ok := tagSettings["belongsTo"]; ok {
+			if withType == Many {
+				return nil
+			}
+			return makeBelongsTo(with, tagSettings, schema1)
 		}
 
 		foreignKey, ok := tagSettings["foreignKey"]
@@ -65,3 +128,124 @@ func MakeWith(p reflect.StructField, dialect IDialect, tagSettings map[string]st
 	}
 	return nil
 }
+
+// makeBelongsTo 外键在当前模型上，例如 Post.UserId 关联 User.Id
+func makeBelongsTo(with *With, tagSettings map[string]string, schema1 *Schema) *With {
+	with.Type = BelongsTo
+
+	foreignKey, ok := tagSettings["foreignKey"]
+	if !ok {
+		if with.Schema.PrimaryKey == nil {
+			return nil
+		}
+		foreignKey = with.Schema.TableName + "_" + with.Schema.PrimaryKey.FieldName
+	}
+
+	ownerKey, ok := tagSettings["ownerKey"]
+	if ok {
+		with.ForeignKey = with.Schema.GetField(ownerKey)
+	} else {
+		with.ForeignKey = with.Schema.PrimaryKey
+	}
+
+	with.LocalKey = schema1.GetField(foreignKey)
+
+	if with.LocalKey == nil || with.ForeignKey == nil {
+		return nil
+	}
+	return with
+}
+
+// makeManyToMany 通过中间表关联，例如 user_roles.user_id 关联 User.Id，user_roles.role_id 关联 Role.Id
+func makeManyToMany(with *With, joinTable string, tagSettings map[string]string, schema1 *Schema) *With {
+	with.Type = ManyToMany
+
+	localKey, ok := tagSettings["localKey"]
+	if ok {
+		with.LocalKey = schema1.GetField(localKey)
+	} else {
+		with.LocalKey = schema1.PrimaryKey
+	}
+
+	foreignKey, ok := tagSettings["foreignKey"]
+	if ok {
+		with.ForeignKey = with.Schema.GetField(foreignKey)
+	} else {
+		with.ForeignKey = with.Schema.PrimaryKey
+	}
+
+	if with.LocalKey == nil || with.ForeignKey == nil {
+		return nil
+	}
+
+	if joinTable == "" {
+		joinTable = schema1.TableName + "_" + with.Schema.TableName
+	}
+	with.JoinTable = joinTable
+
+	with.JoinForeignKey, ok = tagSettings["joinForeignKey"]
+	if !ok {
+		with.JoinForeignKey = schema1.TableName + "_" + with.LocalKey.FieldName
+	}
+
+	with.JoinReferences, ok = tagSettings["joinReferences"]
+	if !ok {
+		with.JoinReferences = with.Schema.TableName + "_" + with.ForeignKey.FieldName
+	}
+
+	return with
+}
+
+// makePolymorphic 多态关联，关联模型通过 <name>_id、<name>_type 两个字段关联多种模型，
+// 例如 comment.commentable_id 关联 Post.Id，comment.commentable_type 为 post
+func makePolymorphic(with *With, name string, tagSettings map[string]string, schema1 *Schema) *With {
+	if with.Type == Many {
+		with.Type = MorphMany
+	} else {
+		with.Type = MorphOne
+	}
+
+	if name == "" {
+		name = with.Name
+	}
+	name = SnakeString(name)
+
+	with.ForeignKey = with.Schema.GetField(name + "_id")
+	with.MorphType = with.Schema.GetField(name + "_type")
+
+	localKey, ok := tagSettings["localKey"]
+	if ok {
+		with.LocalKey = schema1.GetField(localKey)
+	} else {
+		with.LocalKey = schema1.PrimaryKey
+	}
+
+	if with.LocalKey == nil || with.ForeignKey == nil || with.MorphType == nil {
+		return nil
+	}
+	return with
+}
+
+// makeMorphTo 多态关联的反向关联，<name>_type 对应的模型通过 RegisterMorph 注册，
+// 例如 Comment.Commentable 根据 commentable_type 关联 Post 或 Video
+func makeMorphTo(p reflect.StructField, tagSettings map[string]string, schema1 *Schema) *With {
+	name := tagSettings["polymorphic"]
+	if name == "" {
+		name = p.Name
+	}
+	name = SnakeString(name)
+
+	with := &With{
+		Type:          MorphTo,
+		Name:          p.Name,
+		ModelType:     p.Type,
+		Relationships: make(map[any][]reflect.Value, 0),
+		LocalKey:      schema1.GetField(name + "_id"),
+		MorphType:     schema1.GetField(name + "_type"),
+	}
+
+	if with.LocalKey == nil || with.MorphType == nil {
+		return nil
+	}
+	return with
+}
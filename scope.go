@@ -0,0 +1,95 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"sort"
+)
+
+// SoftDeleteScope 内置的软删除全局作用域，WithoutGlobalScope(SoftDeleteScope) 与 WithDelete 相同
+const SoftDeleteScope = "softDelete"
+
+// ScopeFunc 查询作用域，在查询上添加条件后返回
+type ScopeFunc func(*DB) *DB
+
+// Scopes 执行局部作用域
+//
+//	func Paid(db *orm.DB) *orm.DB {
+//		return db.Where("status", "paid")
+//	}
+//
+//	err := db.Scopes(Paid).Get(&orders)
+func (d *DB) Scopes(scopes ...ScopeFunc) *DB {
+	db := d.getInstance()
+	for _, scope := range scopes {
+		db = scope(db)
+	}
+	return db
+}
+
+// WithoutGlobalScope 不执行指定名称的全局作用域，不传名称时不执行所有全局作用域
+func (d *DB) WithoutGlobalScope(names ...string) *DB {
+	db := d.getInstance()
+
+	if len(names) == 0 {
+		db.withoutScopes = map[string]bool{"*": true}
+		return db
+	}
+
+	withoutScopes := make(map[string]bool, len(db.withoutScopes)+len(names))
+	for name := range db.withoutScopes {
+		withoutScopes[name] = true
+	}
+	for _, name := range names {
+		withoutScopes[name] = true
+	}
+	db.withoutScopes = withoutScopes
+	return db
+}
+
+// withoutScope 是否跳过指定名称的全局作用域
+func (d *DB) withoutScope(name string) bool {
+	return d.withoutScopes["*"] || d.withoutScopes[name]
+}
+
+// applyScopes 执行模型的全局作用域及内置的软删除作用域，table 为软删除字段所属的表名或别名
+func (d *DB) applyScopes(tableInfo *schema.Schema, table string) {
+	d.applySoftDelete(tableInfo, table)
+	d.applyGlobalScopes(tableInfo, table)
+}
+
+// applyGlobalScopes 执行内置的多租户作用域及模型声明的全局作用域，按名称排序保证生成的语句一致
+func (d *DB) applyGlobalScopes(tableInfo *schema.Schema, table string) {
+	if tableInfo == nil {
+		return
+	}
+
+	d.applyTenant(tableInfo, table)
+
+	model, ok := tableInfo.Model.(IGlobalScopes)
+	if !ok {
+		return
+	}
+
+	scopes := model.GlobalScopes()
+	names := make([]string, 0, len(scopes))
+	for name := range scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !d.withoutScope(name) {
+			scopes[name](d)
+		}
+	}
+}
+
+// cloneToTx 把当前的查询条件复制到事务中的 tx
+func (d *DB) cloneToTx(tx *DB) *DB {
+	query := tx.ClonePure(1)
+	query.b = d.b
+	query.conditions = d.conditions
+	query.onlyTrashed = d.onlyTrashed
+	query.withoutScopes = d.withoutScopes
+	return query
+}
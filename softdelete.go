@@ -0,0 +1,156 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+// OnlyTrashed 只查询软删除的记录
+func (d *DB) OnlyTrashed() *DB {
+	db := d.getInstance()
+	db.onlyTrashed = true
+	return db
+}
+
+// IsTrashed 模型是否已被软删除，根据模型的软删除字段及其方式判断，不支持软删除的模型为 false
+func (d *DB) IsTrashed(value any) bool {
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	tableInfo := schema.Parse(value, d.dialector, d.TablePrefix)
+	if tableInfo.SoftDelete == nil {
+		return false
+	}
+	return tableInfo.SoftDelete.Trashed(val.Elem())
+}
+
+// ForceDelete 强制删除，支持软删除的模型也会从数据库中删除
+func (d *DB) ForceDelete(value any) (int64, error) {
+	return d.Delete(value, true)
+}
+
+// applySoftDelete 内置的软删除全局作用域，根据 WithDelete、OnlyTrashed 过滤软删除的记录，
+// table 为软删除字段所属的表名或别名，可以为空
+func (d *DB) applySoftDelete(tableInfo *schema.Schema, table string) {
+	if tableInfo == nil || tableInfo.SoftDelete == nil {
+		return
+	}
+
+	switch {
+	case d.onlyTrashed:
+		d.whereTrashed(tableInfo.SoftDelete, table, true)
+	case !d.withDel && !d.withoutScope(SoftDeleteScope):
+		d.whereTrashed(tableInfo.SoftDelete, table, false)
+	}
+}
+
+// whereTrashed 按软删除字段的处理方式添加条件，trashed 为 true 时查询已删除的记录
+func (d *DB) whereTrashed(field *schema.Field, table string, trashed bool) {
+	column := field.FieldName
+	if table != "" {
+		column = table + "." + column
+	}
+
+	switch {
+	case field.SoftDelete == schema.SoftDeleteTime && trashed:
+		d.WhereNotNull(column)
+	case field.SoftDelete == schema.SoftDeleteTime:
+		d.WhereNull(column)
+	case trashed:
+		d.Where(column, "!=", 0)
+	default:
+		d.Where(column, 0)
+	}
+}
+
+// Restore 恢复软删除的记录，声明了 onDelete:cascade 的关联模型中软删除的记录会一起恢复
+//
+//	_, err := db.Restore(&user)
+//	_, err = db.Where("id", "in", ids).Restore(&User{})
+func (d *DB) Restore(value any) (affected int64, err error) {
+	defer d.resetClone()
+	db := d.getInstance()
+	tableInfo := db.getTableInfo(value)
+
+	if tableInfo.SoftDelete == nil {
+		return 0, ErrNotSoftDelete
+	}
+
+	if db.tx == nil && len(restoreWiths(tableInfo)) > 0 {
+		err = db.Transaction(func(query *DB) error {
+			affected, err = db.cloneToTx(query).Restore(value)
+			return err
+		})
+		return
+	}
+
+	if db.b.GetTable() == "" {
+		db.b.Table(tableInfo.TableName)
+	}
+
+	if err = db.applyConditions(tableInfo); err != nil {
+		return
+	}
+
+	if len(db.b.GetWhere()) == 0 {
+		primaryKey, ok := primaryKeyValue(tableInfo)
+		if !ok {
+			return 0, ErrMissingCondition
+		}
+		db.Where(tableInfo.PrimaryKey.FieldName, primaryKey)
+	}
+
+	db.whereTrashed(tableInfo.SoftDelete, "", true)
+	db.applyGlobalScopes(tableInfo, "")
+	// 条件中已经限定为软删除的记录并执行了全局作用域，更新时不再执行
+	db.withoutScopes = map[string]bool{"*": true}
+	db.onlyTrashed = false
+
+	withs := restoreWiths(tableInfo)
+
+	var allKeys map[string][]any
+	if len(withs) > 0 {
+		// 恢复后就不能通过软删除字段找到这些记录，需要先取出关联键
+		if allKeys, err = db.relationKeys(withs); err != nil {
+			return
+		}
+	}
+
+	softDelete := tableInfo.SoftDelete
+	if affected, err = db.Update(map[string]any{softDelete.FieldName: softDelete.RestoreValue()}); err != nil {
+		return
+	}
+
+	if tableInfo.Value.IsValid() {
+		if field := tableInfo.Value.FieldByName(softDelete.Name); field.CanSet() {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	for _, with := range withs {
+		keys := allKeys[with.LocalKey.Name]
+		if len(keys) == 0 {
+			continue
+		}
+
+		if _, err = db.relatedQuery(with, tableInfo, keys).Restore(reflect.New(with.ModelType).Interface()); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// restoreWiths 恢复时需要一起恢复的关联，即 cascade 且关联模型支持软删除
+func restoreWiths(tableInfo *schema.Schema) []*schema.With {
+	withs := make([]*schema.With, 0)
+	for _, with := range cascadeWiths(tableInfo) {
+		if with.OnDelete == OnDeleteCascade && with.Type != schema.ManyToMany &&
+			with.Schema.SoftDelete != nil {
+			withs = append(withs, with)
+		}
+	}
+	return withs
+}
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/kwinh/go-orm/drive/sqlite3"
 	"testing"
@@ -18,3 +19,110 @@ func TestDB_Fin1(t *testing.T) {
 	}
 
 }
+
+func TestSqlite_Migrate(t *testing.T) {
+	db, err := Open(sqlite3.Open("max.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Goods struct {
+		Model
+		Name  string `orm:"unique"`
+		Price float64
+		Stock int `orm:"index"`
+	}
+
+	if err = db.Migrate.Auto(Goods{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if !db.Migrate.TableExist("goods") {
+		t.Error("table goods not exist")
+	}
+
+	tableInfo := db.Migrate.TableInfo("goods")
+	if tableInfo.PrimaryKey != "id" {
+		t.Errorf("primary key %v", tableInfo.PrimaryKey)
+	}
+
+	if _, ok := tableInfo.UniqueKeys["name_uni"]; !ok {
+		t.Errorf("unique keys %v", tableInfo.UniqueKeys)
+	}
+}
+
+func TestSqlite_RebuildRollback(t *testing.T) {
+	db, err := Open(sqlite3.Open("max.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Draft struct {
+		Model
+		Title string
+	}
+
+	_, _ = db.Exec("DROP TABLE IF EXISTS `draft`")
+	if _, err = db.Exec("CREATE TABLE `draft` (`id` integer PRIMARY KEY AUTOINCREMENT, `title` text DEFAULT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("INSERT INTO `draft` (`title`) VALUES (NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// title 改为 NOT NULL 时复制数据失败，重建表需要整体回滚
+	if err = db.Migrate.Auto(Draft{}, true, true); err == nil {
+		t.Fatal("rebuild with null title should fail")
+	}
+
+	if db.Migrate.TableExist("new_draft") {
+		t.Error("table new_draft left behind")
+	}
+
+	count, err := db.Table("draft").Count()
+	if err != nil || count != 1 {
+		t.Errorf("count %d %v", count, err)
+	}
+}
+
+func TestSqlite_RebuildMemory(t *testing.T) {
+	dialect := sqlite3.Open(":memory:")
+	db, err := Open(dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 内存数据库的每个连接都是独立的数据库，重建表必须使用同一个连接
+	if stats := dialect.Conn.(*sql.DB).Stats(); stats.MaxOpenConnections != 1 {
+		t.Errorf("max open connections %d", stats.MaxOpenConnections)
+	}
+
+	type Note struct {
+		Model
+		Title string
+	}
+
+	if err = db.Migrate.Auto(Note{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Create(&Note{Title: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多出的列只能通过重建表删除
+	if _, err = db.Exec("ALTER TABLE `note` ADD COLUMN `legacy` int"); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Migrate.Auto(Note{}, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.Migrate.TableInfo("note").FieldsInfo["legacy"]; ok {
+		t.Error("column legacy not dropped")
+	}
+
+	var notes []Note
+	if err = db.Get(&notes); err != nil || len(notes) != 1 || notes[0].Title != "memory" {
+		t.Errorf("notes %+v %v", notes, err)
+	}
+}
@@ -0,0 +1,168 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+// TenantScope 内置的多租户全局作用域，WithoutGlobalScope(TenantScope) 可以跨租户查询和写入
+const TenantScope = "tenant"
+
+type tenantKey struct{}
+
+// TenantError 写入的记录不属于当前租户，errors.Is(err, ErrCrossTenant) 为 true
+type TenantError struct {
+	Table string
+	// Tenant 当前租户
+	Tenant any
+	// Value 记录中的租户
+	Value any
+}
+
+func (e *TenantError) Error() string {
+	return fmt.Sprintf("%s: %s.%v, current tenant %v", ErrCrossTenant, e.Table, e.Value, e.Tenant)
+}
+
+func (e *TenantError) Unwrap() error {
+	return ErrCrossTenant
+}
+
+// ContextWithTenant 把租户写入 context，没有设置 Config.TenantResolver 时从 context 中取得当前租户
+//
+//	db.WithContext(orm.ContextWithTenant(ctx, 1)).Get(&users)
+func ContextWithTenant(ctx context.Context, tenant any) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext 取得 ContextWithTenant 写入的租户
+func TenantFromContext(ctx context.Context) (any, bool) {
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+// WithTenant 指定当前租户，优先于 context 中的租户，关联查询也使用这个租户
+func (d *DB) WithTenant(tenant any) *DB {
+	db := d.getInstance()
+	db.tenant = tenant
+	return db
+}
+
+// currentTenant 当前租户，没有配置 TenantColumn、没有租户或跳过了多租户作用域时 ok 为 false
+func (d *DB) currentTenant() (any, bool) {
+	if d.TenantColumn == "" || d.withoutScope(TenantScope) {
+		return nil, false
+	}
+
+	if d.tenant != nil {
+		return d.tenant, true
+	}
+
+	if d.TenantResolver != nil {
+		return d.TenantResolver(d.Context())
+	}
+	return TenantFromContext(d.Context())
+}
+
+// tenantField 模型的租户字段，模型没有租户字段或没有当前租户时返回 nil
+func (d *DB) tenantField(tableInfo *schema.Schema) (*schema.Field, any) {
+	if tableInfo == nil {
+		return nil, nil
+	}
+
+	tenant, ok := d.currentTenant()
+	if !ok {
+		return nil, nil
+	}
+
+	field := tableInfo.GetField(d.TenantColumn)
+	if field == nil {
+		return nil, nil
+	}
+	return field, tenant
+}
+
+// applyTenant 只查询、更新、删除当前租户的记录，table 为租户字段所属的表名或别名
+func (d *DB) applyTenant(tableInfo *schema.Schema, table string) {
+	field, tenant := d.tenantField(tableInfo)
+	if field == nil {
+		return
+	}
+
+	column := field.FieldName
+	if table != "" {
+		column = table + "." + column
+	}
+	d.Where(column, tenant)
+}
+
+// fillTenant 写入模型时填充租户字段，模型中已经是其他租户时返回 TenantError；
+// values 为写入的字段，Select 没有选择租户字段时也会写入
+func (d *DB) fillTenant(tableInfo *schema.Schema, values map[string]any) error {
+	field, tenant := d.tenantField(tableInfo)
+	if field == nil {
+		return nil
+	}
+
+	value := tableInfo.Value.FieldByName(field.Name)
+	if value.IsZero() {
+		tenantValue := reflect.ValueOf(tenant)
+		if !tenantValue.CanConvert(value.Type()) {
+			return fmt.Errorf("%w: tenant %v", ErrParam, tenant)
+		}
+		value.Set(tenantValue.Convert(value.Type()))
+	} else if err := checkTenant(tableInfo, tenant, value.Interface()); err != nil {
+		return err
+	}
+
+	if values != nil {
+		values[field.FieldName] = value.Interface()
+	}
+	return nil
+}
+
+// checkTenantValues 写入的字段中包含租户字段时必须是当前租户，insert 为 true 时补充租户字段
+func (d *DB) checkTenantValues(tableInfo *schema.Schema, values map[string]any, insert bool) (map[string]any, error) {
+	field, tenant := d.tenantField(tableInfo)
+	if field == nil {
+		return values, nil
+	}
+
+	if value, ok := values[field.FieldName]; ok {
+		return values, checkTenant(tableInfo, tenant, value)
+	}
+
+	if !insert {
+		return values, nil
+	}
+
+	// 不修改调用方传入的 map
+	filled := make(map[string]any, len(values)+1)
+	for k, v := range values {
+		filled[k] = v
+	}
+	filled[field.FieldName] = tenant
+	return filled, nil
+}
+
+// checkModelTenant 删除的模型中有租户时必须是当前租户
+func (d *DB) checkModelTenant(tableInfo *schema.Schema) error {
+	field, tenant := d.tenantField(tableInfo)
+	if field == nil {
+		return nil
+	}
+
+	value := tableInfo.Value.FieldByName(field.Name)
+	if value.IsZero() {
+		return nil
+	}
+	return checkTenant(tableInfo, tenant, value.Interface())
+}
+
+func checkTenant(tableInfo *schema.Schema, tenant, value any) error {
+	if fmt.Sprint(tenant) != fmt.Sprint(value) {
+		return &TenantError{Table: tableInfo.TableName, Tenant: tenant, Value: value}
+	}
+	return nil
+}
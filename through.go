@@ -0,0 +1,107 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	sqlBuilder "github.com/kwinh/go-sql-builder"
+	"reflect"
+	"sync"
+)
+
+// RegisterModel 注册模型的名称，远程关联的 through 标签为注册的名称时使用中间模型，
+// 查询时会执行中间模型的软删除、多租户等作用域；在解析关联模型之后注册的，下次查询时生效
+//
+//	orm.RegisterModel("user", &User{})
+func RegisterModel(name string, model any) {
+	schema.RegisterModel(name, model)
+}
+
+// setThroughRelationships 远程关联：关联模型 JOIN 中间模型的表，一次查询出关联模型及其所属的当前模型的关联键
+//
+//	SELECT `post`.`id`,...,`user`.`country_id` FROM `post` INNER JOIN `user` ON `user`.`id` = `post`.`user_id` WHERE `user`.`country_id` in (1,2)
+func (d *DB) setThroughRelationships(with *With) {
+	tableInfo := with.Schema
+	relatedTable := tableInfo.TableName
+
+	db := d.ClonePure(1)
+
+	for modelName, funcList := range d.childWiths {
+		db.With(modelName, funcList...)
+	}
+
+	with.Callback(db)
+
+	fields := make([]any, 0, len(tableInfo.Fields)+1)
+	for _, field := range tableInfo.Fields {
+		if field.Raw {
+			fields = append(fields, sqlBuilder.Raw(field.FieldName))
+		} else {
+			fields = append(fields, sqlBuilder.Raw(fmt.Sprintf("`%s`.`%s`", relatedTable, field.FieldName)))
+		}
+	}
+	fields = append(fields, sqlBuilder.Raw(fmt.Sprintf("`%s`.`%s`", with.JoinTable, with.JoinForeignKey)))
+
+	db.b.Table(relatedTable).Select(fields...).
+		Join(with.JoinTable, fmt.Sprintf("ON `%s`.`%s` = `%s`.`%s`",
+			with.JoinTable, with.JoinReferences, relatedTable, with.ForeignKey.FieldName)).
+		Where(with.JoinTable+"."+with.JoinForeignKey, "in", with.Values)
+
+	if err := db.applyConditions(tableInfo); err != nil {
+		d.AddError(err)
+		return
+	}
+
+	db.applyScopes(tableInfo, relatedTable)
+	db.applyScopes(with.Through, with.JoinTable)
+
+	db.sql, db.bindings = db.b.ToSql()
+
+	rows, err := db.query(db.sql, db.bindings...)
+	if err != nil {
+		d.AddError(err)
+		return
+	}
+	defer rows.Close()
+
+	withs := db.makeWiths(tableInfo)
+
+	var dests []reflect.Value
+	var keys []any
+	for rows.Next() {
+		key := reflect.New(with.LocalKey.StructField.Type)
+		dest, err := db.rowHandle(tableInfo, rows, key.Interface())
+		if err != nil {
+			d.AddError(err)
+			return
+		}
+
+		dests = append(dests, dest)
+		keys = append(keys, key.Elem().Interface())
+		db.getWiths(withs, dest)
+	}
+
+	if err = rows.Err(); err != nil {
+		d.AddError(err)
+		return
+	}
+
+	// 关联模型上的嵌套关联
+	db.relationships(withs)
+	if db.Error != nil {
+		d.AddError(db.Error)
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, dest := range dests {
+		for _, w := range withs {
+			wg.Add(1)
+			db.setDestRelationship(w, dest, wg)
+		}
+	}
+	wg.Wait()
+
+	for i, dest := range dests {
+		with.Relationships[keys[i]] = append(with.Relationships[keys[i]], dest)
+	}
+}
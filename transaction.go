@@ -1,20 +1,49 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"sync/atomic"
 	"time"
 )
 
 type ITransaction interface {
 	Begin() (*sql.Tx, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
+// TxOptions 事务选项
+type TxOptions struct {
+	// Isolation 隔离级别，为 sql.LevelDefault 时使用数据库的默认隔离级别
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries 死锁、锁等待超时、序列化失败时重试整个事务的最大次数
+	MaxRetries int
+	// Backoff 第一次重试前的等待时间，之后每次重试等待时间翻倍
+	Backoff time.Duration
+}
+
+// Begin 开始事务，已经在事务中时创建保存点，Commit 时释放保存点，Rollback 时回滚到保存点
 func (d *DB) Begin() (*DB, error) {
+	return d.begin(nil)
+}
+
+func (d *DB) begin(opts *sql.TxOptions) (*DB, error) {
 	start := time.Now()
 	var err error
 	db := d.ClonePure(0)
 
-	db.tx, err = db.connPool.(ITransaction).Begin()
+	if d.tx != nil {
+		db.savepoint = fmt.Sprintf("sp_%d", atomic.AddInt64(d.savepoints, 1))
+		db.callbacks = &txCallbacks{parent: d.callbacks}
+		return db, db.SavePoint(db.savepoint)
+	}
+
+	db.savepoints = new(int64)
+	db.callbacks = &txCallbacks{}
+	db.tx, err = db.connPool.(ITransaction).BeginTx(db.Context(), opts)
 
 	if err != nil {
 		db.Logger.Error("Transaction Begin %v", err)
@@ -25,7 +54,24 @@ func (d *DB) Begin() (*DB, error) {
 	return db, err
 }
 
+// Commit 提交事务后执行 AfterCommit 注册的回调，提交失败时执行 AfterRollback 注册的回调；
+// 嵌套事务释放保存点，回调跟随外层事务执行，释放失败时回滚到保存点并执行 AfterRollback 注册的回调
 func (d *DB) Commit() (err error) {
+	if d.savepoint != "" {
+		if err = d.execSavepoint("RELEASE SAVEPOINT", d.savepoint); err != nil {
+			_ = d.RollbackTo(d.savepoint)
+			if d.callbacks != nil {
+				d.callbacks.done(false)
+			}
+			return
+		}
+
+		if d.callbacks != nil {
+			d.callbacks.release()
+		}
+		return
+	}
+
 	start := time.Now()
 	err = d.tx.Commit()
 
@@ -33,24 +79,110 @@ func (d *DB) Commit() (err error) {
 		d.Logger.Error("Transaction Commit %v", err)
 	}
 	d.Logger.Trace("Transaction Commit", []any{}, start)
+
+	if d.callbacks != nil {
+		d.callbacks.done(err == nil)
+	}
 	return
 }
 
+// Rollback 回滚事务后执行 AfterRollback 注册的回调，嵌套事务回滚到保存点并释放保存点
 func (d *DB) Rollback() (err error) {
+	if d.savepoint != "" {
+		// 回滚到保存点后保存点仍然存在
+		if err = d.RollbackTo(d.savepoint); err == nil {
+			err = d.execSavepoint("RELEASE SAVEPOINT", d.savepoint)
+		}
+	} else {
+		start := time.Now()
+		err = d.tx.Rollback()
+
+		if err != nil {
+			d.Logger.Error("Transaction Rollback %v", err)
+		}
+		d.Logger.Trace("Transaction Rollback", []any{}, start)
+	}
+
+	if d.callbacks != nil {
+		d.callbacks.done(false)
+	}
+	return
+}
+
+// SavePoint 在当前事务中创建保存点
+func (d *DB) SavePoint(name string) error {
+	return d.execSavepoint("SAVEPOINT", name)
+}
+
+// RollbackTo 回滚到保存点，保存点之前的操作不受影响
+func (d *DB) RollbackTo(name string) error {
+	return d.execSavepoint("ROLLBACK TO SAVEPOINT", name)
+}
+
+// execSavepoint 保存点语句不能预处理，直接在事务中执行
+func (d *DB) execSavepoint(statement string, name string) error {
+	if d.tx == nil {
+		return ErrMissingTx
+	}
+
 	start := time.Now()
-	err = d.tx.Rollback()
+	query := fmt.Sprintf("%s `%s`", statement, name)
 
+	_, err := d.tx.ExecContext(d.Context(), d.rebind(query))
 	if err != nil {
-		d.Logger.Error("Transaction Rollback %v", err)
+		d.Logger.Error("%s %v", query, err)
 	}
-	d.Logger.Trace("Transaction Rollback", []any{}, start)
-	return
+	d.Logger.Trace(query, []any{}, start)
+	return err
 }
 
 type TxFunc func(*DB) error
 
 func (d *DB) Transaction(f TxFunc) (err error) {
-	db, err := d.Begin()
+	return d.transaction(nil, f)
+}
+
+// TransactionWith 按 opts 开始事务，数据库返回死锁等可以重试的错误时重新执行 f，
+// 已经在事务中时创建保存点，不使用 opts
+//
+//	err := db.TransactionWith(orm.TxOptions{Isolation: sql.LevelSerializable, MaxRetries: 3, Backoff: 10 * time.Millisecond}, func(tx *orm.DB) error {
+//		return nil
+//	})
+func (d *DB) TransactionWith(opts TxOptions, f TxFunc) (err error) {
+	if d.tx != nil {
+		return d.Transaction(f)
+	}
+
+	txOptions := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	backoff := opts.Backoff
+
+	for retry := 1; ; retry++ {
+		err = d.transaction(txOptions, f)
+		if err == nil || retry > opts.MaxRetries || !d.retryable(err) {
+			return
+		}
+
+		d.Logger.Info("Transaction retry %d/%d after %v: %v", retry, opts.MaxRetries, backoff, err)
+
+		select {
+		case <-d.Context().Done():
+			return d.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// retryable 方言判断错误是否可以重试整个事务
+func (d *DB) retryable(err error) bool {
+	if retry, ok := d.dialector.(schema.IRetry); ok {
+		return retry.Retryable(err)
+	}
+	return false
+}
+
+func (d *DB) transaction(opts *sql.TxOptions, f TxFunc) (err error) {
+	db, err := d.begin(opts)
 
 	if err != nil {
 		return
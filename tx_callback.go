@@ -0,0 +1,114 @@
+package orm
+
+import (
+	"reflect"
+	"sync"
+)
+
+// txCallbacks 事务提交、回滚后执行的回调，嵌套事务释放保存点时合并到外层事务
+type txCallbacks struct {
+	mu        sync.Mutex
+	parent    *txCallbacks
+	commits   []func()
+	rollbacks []func()
+}
+
+func (c *txCallbacks) addCommit(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commits = append(c.commits, f)
+}
+
+func (c *txCallbacks) addRollback(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollbacks = append(c.rollbacks, f)
+}
+
+// release 保存点释放后，内层事务的回调跟随外层事务执行
+func (c *txCallbacks) release() {
+	c.mu.Lock()
+	commits, rollbacks := c.commits, c.rollbacks
+	c.commits, c.rollbacks = nil, nil
+	c.mu.Unlock()
+
+	for _, f := range commits {
+		c.parent.addCommit(f)
+	}
+	for _, f := range rollbacks {
+		c.parent.addRollback(f)
+	}
+}
+
+// done 事务结束时按注册顺序执行提交或回滚的回调
+func (c *txCallbacks) done(committed bool) {
+	c.mu.Lock()
+	callbacks := c.rollbacks
+	if committed {
+		callbacks = c.commits
+	}
+	c.commits, c.rollbacks = nil, nil
+	c.mu.Unlock()
+
+	for _, f := range callbacks {
+		f()
+	}
+}
+
+// AfterCommit 事务提交后执行 f，嵌套事务要等最外层事务提交后执行，不在事务中时立即执行
+//
+//	db.AfterCommit(func() {
+//		cache.Delete(key)
+//	})
+func (d *DB) AfterCommit(f func()) {
+	if d.tx == nil || d.callbacks == nil {
+		f()
+		return
+	}
+	d.callbacks.addCommit(f)
+}
+
+// AfterRollback 事务回滚后执行 f，嵌套事务回滚到保存点时也会执行；不在事务中时语句已经生效，不会执行
+func (d *DB) AfterRollback(f func()) {
+	if d.tx == nil || d.callbacks == nil {
+		return
+	}
+	d.callbacks.addRollback(f)
+}
+
+// afterCommitCreate 事务提交后执行模型的 IAfterCommitCreate 钩子
+func (d *DB) afterCommitCreate(value reflect.Value) {
+	if model, ok := value.Addr().Interface().(IAfterCommitCreate); ok {
+		db := d.withoutTx()
+		d.AfterCommit(func() {
+			model.AfterCommitCreate(db)
+		})
+	}
+}
+
+// afterCommitUpdate 事务提交后执行模型的 IAfterCommitUpdate 钩子
+func (d *DB) afterCommitUpdate(value reflect.Value) {
+	if model, ok := value.Addr().Interface().(IAfterCommitUpdate); ok {
+		db := d.withoutTx()
+		d.AfterCommit(func() {
+			model.AfterCommitUpdate(db)
+		})
+	}
+}
+
+// afterCommitDelete 事务提交后执行模型的 IAfterCommitDelete 钩子
+func (d *DB) afterCommitDelete(value reflect.Value) {
+	if model, ok := value.Addr().Interface().(IAfterCommitDelete); ok {
+		db := d.withoutTx()
+		d.AfterCommit(func() {
+			model.AfterCommitDelete(db)
+		})
+	}
+}
+
+// withoutTx 事务结束后执行的钩子使用不在事务中的 DB
+func (d *DB) withoutTx() *DB {
+	db := d.ClonePure(0)
+	db.tx, db.savepoint, db.savepoints, db.callbacks = nil, "", nil, nil
+	return db
+}
@@ -0,0 +1,152 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OnConflict 插入的记录与主键、唯一索引冲突时的处理方式
+type OnConflict struct {
+	// Columns 判断冲突的字段，为空时使用主键；mysql 根据所有唯一索引判断冲突，不需要指定
+	Columns []string
+	// Update 冲突时更新的字段，为空时更新插入的字段中除冲突字段、主键、创建时间之外的所有字段
+	Update []string
+	// DoNothing 冲突时不做处理
+	DoNothing bool
+}
+
+// Upsert 插入记录，冲突时按 conflict 更新或忽略，按方言生成
+// ON DUPLICATE KEY UPDATE、ON CONFLICT ... DO UPDATE SET、INSERT OR IGNORE 等语句，
+// 可以传入结构体、结构体切片、map，不会写入关联模型；
+// 无法区分每条记录是新增还是更新，不执行模型的钩子和观察者，能对应到每条记录时回写主键；
+// 多租户作用域生效时返回 ErrCrossTenant
+//
+//	// INSERT INTO `user` (...) VALUES (...) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)
+//	_, err := db.Upsert(&users, orm.OnConflict{Columns: []string{"email"}, Update: []string{"name"}})
+func (d *DB) Upsert(values any, conflict OnConflict) (int64, error) {
+	db := d.getInstance()
+	db.onConflict = &conflict
+	db.withs = nil
+	return db.insertReplace("INSERT", values)
+}
+
+// upsertSql 在 INSERT 语句上加上冲突处理，没有实现 schema.IUpsert 的方言使用 mysql 的语法
+func (d *DB) upsertSql(sql string, values []any) (string, error) {
+	// 冲突的记录可能属于其他租户，多租户作用域生效时不允许 Upsert，需要时用 WithoutGlobalScope(TenantScope) 跳过
+	if field, _ := d.tenantField(d.schema); field != nil {
+		return "", fmt.Errorf("%w: upsert %s", ErrCrossTenant, d.schema.TableName)
+	}
+
+	conflict := *d.onConflict
+
+	if len(conflict.Columns) == 0 && d.schema != nil && d.schema.PrimaryKey != nil {
+		conflict.Columns = []string{d.schema.PrimaryKey.FieldName}
+	}
+
+	if !conflict.DoNothing && len(conflict.Update) == 0 {
+		conflict.Update = d.upsertColumns(conflict.Columns, values)
+		if len(conflict.Update) == 0 {
+			conflict.DoNothing = true
+		}
+	}
+
+	if upsert, ok := d.dialector.(schema.IUpsert); ok {
+		if !conflict.DoNothing && len(conflict.Columns) == 0 {
+			return "", ErrMissingConflict
+		}
+		return upsert.Upsert(sql, conflict.Columns, conflict.Update, conflict.DoNothing), nil
+	}
+
+	// 整数主键用 LAST_INSERT_ID(主键) 记下冲突的记录，写入一条记录时可以通过 LastInsertId 回写主键；
+	// DoNothing 不使用 INSERT IGNORE，它会把冲突以外的错误也变成警告
+	sets := make([]string, 0, len(conflict.Update)+1)
+	if key := d.upsertKey(conflict); key != "" {
+		sets = append(sets, key)
+	} else if conflict.DoNothing {
+		return "", ErrMissingConflict
+	}
+
+	if !conflict.DoNothing {
+		for _, field := range conflict.Update {
+			sets = append(sets, fmt.Sprintf("`%s`=VALUES(`%s`)", field, field))
+		}
+	}
+	return sql + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ","), nil
+}
+
+// upsertKey mysql 冲突时赋值给自身的字段，没有主键时使用第一个冲突字段
+func (d *DB) upsertKey(conflict OnConflict) string {
+	if d.schema != nil && d.schema.PrimaryKey != nil {
+		key := d.schema.PrimaryKey
+		if key.DataType == schema.Int || key.DataType == schema.Uint {
+			return fmt.Sprintf("`%s`=LAST_INSERT_ID(`%s`)", key.FieldName, key.FieldName)
+		}
+		return fmt.Sprintf("`%s`=`%s`", key.FieldName, key.FieldName)
+	}
+
+	if len(conflict.Columns) > 0 {
+		return fmt.Sprintf("`%s`=`%s`", conflict.Columns[0], conflict.Columns[0])
+	}
+	return ""
+}
+
+// upsertColumns 冲突时默认更新的字段，按字段名排序保证生成的语句一致
+func (d *DB) upsertColumns(columns []string, values []any) []string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	row, ok := values[0].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	skip := make(map[string]bool, len(columns)+2)
+	for _, column := range columns {
+		skip[column] = true
+	}
+
+	if d.schema != nil {
+		if d.schema.PrimaryKey != nil {
+			skip[d.schema.PrimaryKey.FieldName] = true
+		}
+		if field := d.schema.GetField("CreatedAt"); field != nil {
+			skip[field.FieldName] = true
+		}
+	}
+
+	update := make([]string, 0, len(row))
+	for field := range row {
+		if !skip[field] {
+			update = append(update, field)
+		}
+	}
+	sort.Strings(update)
+	return update
+}
+
+// upsertConflictId RETURNING 没有返回冲突时忽略的记录，按 Columns 查出已有记录的主键并回写，没有指定 Columns 时不回写
+func (d *DB) upsertConflictId(arg any) error {
+	if len(d.onConflict.Columns) == 0 {
+		return nil
+	}
+
+	value := reflect.ValueOf(arg).Elem()
+	db := d.ClonePure(1).Table(d.schema.TableName)
+	for _, column := range d.onConflict.Columns {
+		field := d.schema.GetField(column)
+		if field == nil {
+			return nil
+		}
+		db = db.Where(field.FieldName, value.FieldByName(field.Name).Interface())
+	}
+
+	var id int64
+	if err := db.Value(d.schema.PrimaryKey.FieldName, &id); err != nil {
+		return err
+	}
+	return d.setInsertIds([]any{arg}, []int64{id})
+}
@@ -24,19 +24,47 @@ func (d *DB) structToMap(args ...any) ([]any, []any) {
 		if kind == reflect.Struct {
 
 			tableInfo := d.getTableInfo(arg)
+			// 批量插入时 schema 只解析一次，需要指向当前这条记录
+			tableInfo.Value = reflect.Indirect(reflect.ValueOf(arg))
 
 			if d.b.GetTable() == "" {
 				d.Table(tableInfo.TableName)
 			}
 
+			// 每条记录都执行 BeforeCreate、Saving、Creating，Upsert 不执行模型的钩子和观察者
+			if d.onConflict == nil {
+				if model, ok := tableInfo.Value.Addr().Interface().(IBeforeCreate); ok {
+					if err := model.BeforeCreate(d); err != nil {
+						d.AddError(err)
+						continue
+					}
+				}
+
+				if err := d.observeCreating(tableInfo.Value); err != nil {
+					d.AddError(err)
+					continue
+				}
+			}
+
 			model := tableInfo.Value.Addr().Interface()
 			if modelSetAttr, ok := model.(ISetAttr); ok {
 				modelSetAttr.SetAttr()
 			}
 
-			params = append(params, tableInfo.RecordValues(d.omitEmpty, false))
+			values := tableInfo.RecordValues(d.omitEmpty, false)
+			if err := d.fillTenant(tableInfo, values); err != nil {
+				d.AddError(err)
+			}
+
+			params = append(params, values)
 			structParams = append(structParams, arg)
 		} else if kind == reflect.Map {
+			if values, ok := arg.(map[string]any); ok {
+				var err error
+				if arg, err = d.checkTenantValues(d.schema, values, true); err != nil {
+					d.AddError(err)
+				}
+			}
 			params = append(params, arg)
 		} else if kind == reflect.Slice {
 			ret := make([]any, 0)
@@ -128,3 +156,16 @@ func (d *DB) getField() []any {
 
 	}
 }
+
+// primaryKeyValue 返回模型的主键值，自增主键不会出现在 RecordValues 中，需要直接从结构体读取
+func primaryKeyValue(tableInfo *schema.Schema) (any, bool) {
+	if tableInfo.PrimaryKey == nil || tableInfo.Value.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	value := tableInfo.Value.FieldByName(tableInfo.PrimaryKey.Name)
+	if !value.IsValid() || value.IsZero() {
+		return nil, false
+	}
+	return value.Interface(), true
+}
@@ -0,0 +1,46 @@
+package orm
+
+import (
+	"github.com/kwinh/go-orm/schema"
+	"reflect"
+)
+
+// lockVersion 乐观锁：更新条件中加上当前的版本号，并写入加一后的版本号，
+// 返回加一后的版本号，更新成功后再写回模型
+//
+//	UPDATE `user` SET ...,`version`=2 WHERE `id` = 1 AND `version` = 1
+func (d *DB) lockVersion(tableInfo *schema.Schema, values map[string]any) reflect.Value {
+	field := tableInfo.Version
+	value := tableInfo.Value.FieldByName(field.Name)
+
+	next := reflect.New(value.Type()).Elem()
+	if field.DataType == schema.Uint {
+		next.SetUint(value.Uint() + 1)
+	} else {
+		next.SetInt(value.Int() + 1)
+	}
+
+	d.Where(field.FieldName, value.Interface())
+	values[field.FieldName] = next.Interface()
+	return next
+}
+
+// versionError 按版本号更新没有影响到记录时区分原因：按主键查不到记录（不存在、已软删除或属于其他租户）返回 ErrNotFind，
+// 否则为版本号冲突
+func (d *DB) versionError(tableInfo *schema.Schema) error {
+	primaryKey, ok := primaryKeyValue(tableInfo)
+	if !ok {
+		return ErrStaleObject
+	}
+
+	count, err := d.ClonePure(1).Model(reflect.New(tableInfo.Type).Interface()).
+		Where(tableInfo.PrimaryKey.FieldName, primaryKey).Count()
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFind
+	}
+	return ErrStaleObject
+}